@@ -0,0 +1,169 @@
+// Package amplfile reads the files AMPL exchanges with solvers: the .nl file
+// describing a problem instance and the .sol file holding its solution.
+package amplfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Header holds the problem statistics at the start of an .nl file.
+type Header struct {
+	Binary bool   // binary rather than text .nl file
+	Name   string // problem name from the first line comment, if any
+	Size   int64  // size of the file in bytes, set by ReadNLFile
+
+	Variables, Constraints, Objectives int
+	Ranges, Equations                  int
+	LogicalConstraints                 int
+
+	NonlinearConstraints, NonlinearObjectives int
+	ComplementarityConstraints                int
+
+	NonlinearVariablesInConstraints, NonlinearVariablesInObjectives, NonlinearVariablesInBoth int
+
+	Functions int // imported functions
+
+	// Discrete variables: linear binary and integer ones, then those
+	// appearing nonlinearly in both constraints and objectives, only in
+	// constraints and only in objectives
+	BinaryVariables, IntegerVariables                 int
+	NonlinearIntegerBoth, NonlinearIntegerConstraints int
+	NonlinearIntegerObjectives                        int
+	JacobianNonzeros, GradientNonzeros                int
+}
+
+// Discrete returns the number of binary and integer variables.
+func (h *Header) Discrete() int {
+	return h.BinaryVariables + h.IntegerVariables +
+		h.NonlinearIntegerBoth + h.NonlinearIntegerConstraints + h.NonlinearIntegerObjectives
+}
+
+// Nonlinear reports whether some constraint or objective is nonlinear.
+// Quadratic expressions count as nonlinear, the header does not tell them apart.
+func (h *Header) Nonlinear() bool {
+	return h.NonlinearConstraints+h.NonlinearObjectives > 0
+}
+
+// Class returns the problem class: LP, MILP, NLP or MINLP.
+func (h *Header) Class() string {
+	class := "LP"
+	if h.Nonlinear() {
+		class = "NLP"
+	}
+	if h.Discrete() > 0 {
+		class = "MI" + class
+	}
+	return class
+}
+
+// headerLines gives the minimum number of values on each line of the header
+// after the first, and where to store them. Older AMPL versions write fewer
+// values than there are fields.
+var headerLines = []struct {
+	min    int
+	fields func(h *Header) []*int
+}{
+	{5, func(h *Header) []*int {
+		return []*int{&h.Variables, &h.Constraints, &h.Objectives, &h.Ranges, &h.Equations, &h.LogicalConstraints}
+	}},
+	{2, func(h *Header) []*int {
+		return []*int{&h.NonlinearConstraints, &h.NonlinearObjectives, &h.ComplementarityConstraints}
+	}},
+	{2, func(h *Header) []*int { return []*int{new(int), new(int)} }},
+	{3, func(h *Header) []*int {
+		return []*int{&h.NonlinearVariablesInConstraints, &h.NonlinearVariablesInObjectives, &h.NonlinearVariablesInBoth}
+	}},
+	{2, func(h *Header) []*int { return []*int{new(int), &h.Functions} }},
+	{2, func(h *Header) []*int {
+		return []*int{&h.BinaryVariables, &h.IntegerVariables,
+			&h.NonlinearIntegerBoth, &h.NonlinearIntegerConstraints, &h.NonlinearIntegerObjectives}
+	}},
+	{2, func(h *Header) []*int { return []*int{&h.JacobianNonzeros, &h.GradientNonzeros} }},
+}
+
+// ReadNLHeader reads the header of a text or binary .nl file from r.
+func ReadNLHeader(r io.Reader) (*Header, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return nil, fmt.Errorf("not an .nl file: %v", noEOF(err))
+	}
+	h := &Header{}
+	switch line[0] {
+	case 'g':
+	case 'b':
+		h.Binary = true
+	default:
+		return nil, fmt.Errorf("not an .nl file: unexpected format '%c'", line[0])
+	}
+	values, comment := splitLine(line[1:])
+	if len(values) == 0 {
+		return nil, fmt.Errorf("not an .nl file: missing options on line 1")
+	}
+	if _, err := strconv.Atoi(values[0]); err != nil {
+		return nil, fmt.Errorf("not an .nl file: invalid options on line 1")
+	}
+	if strings.HasPrefix(comment, "problem ") {
+		h.Name = strings.TrimSpace(strings.TrimPrefix(comment, "problem "))
+	}
+	for i, l := range headerLines {
+		line, err := br.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, fmt.Errorf("truncated .nl header on line %d: %v", i+2, noEOF(err))
+		}
+		values, _ := splitLine(line)
+		fields := l.fields(h)
+		if len(values) < l.min {
+			return nil, fmt.Errorf("invalid .nl header on line %d: got %d values, want %d", i+2, len(values), l.min)
+		}
+		for j, v := range values {
+			if j == len(fields) {
+				break
+			}
+			if *fields[j], err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid .nl header on line %d: '%s' is not an integer", i+2, v)
+			}
+		}
+	}
+	return h, nil
+}
+
+// ReadNLFile reads the header of the .nl file at path and records its size.
+func ReadNLFile(path string) (*Header, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h, err := ReadNLHeader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	h.Size = info.Size()
+	return h, nil
+}
+
+// splitLine returns the values of a header line and its comment.
+func splitLine(line string) ([]string, string) {
+	comment := ""
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line, comment = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return strings.Fields(line), comment
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
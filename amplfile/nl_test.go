@@ -0,0 +1,97 @@
+package amplfile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const minlpHeader = `g3 1 1 0	# problem minlp
+ 10 6 1 2 3	# vars, constraints, objectives, ranges, eqns
+ 4 1	# nonlinear constraints, objectives
+ 0 0	# network constraints: nonlinear, linear
+ 5 3 2	# nonlinear vars in constraints, objectives, both
+ 0 1 0 1	# linear network variables; functions; arith, flags
+ 2 1 1 0 0	# discrete variables: binary, integer, nonlinear (b,c,o)
+ 30 8	# nonzeros in Jacobian, gradients
+ 0 0	# max name lengths: constraints, variables
+ 0 0 0 0 0	# common exprs: b,c,o,c1,o1
+C0
+`
+
+func TestReadNLHeader(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		want    Header
+		class   string
+	}{
+		{
+			"text",
+			minlpHeader,
+			Header{Name: "minlp", Variables: 10, Constraints: 6, Objectives: 1, Ranges: 2, Equations: 3,
+				NonlinearConstraints: 4, NonlinearObjectives: 1,
+				NonlinearVariablesInConstraints: 5, NonlinearVariablesInObjectives: 3, NonlinearVariablesInBoth: 2,
+				Functions: 1, BinaryVariables: 2, IntegerVariables: 1, NonlinearIntegerBoth: 1,
+				JacobianNonzeros: 30, GradientNonzeros: 8},
+			"MINLP",
+		},
+		{
+			"binary",
+			"b3 1 1 0\n 3 2 1 0 2 0\n 0 0\n 0 0\n 0 0 0\n 0 0 0 1\n 0 0 0 0 0\n 6 3\n 0 0\n 0 0 0 0 0\nC\x00\x00\x00\x00\xff",
+			Header{Binary: true, Variables: 3, Constraints: 2, Objectives: 1, Equations: 2,
+				JacobianNonzeros: 6, GradientNonzeros: 3},
+			"LP",
+		},
+		{
+			"old discrete line",
+			"g3 1 1 0\n 3 2 1 0 2\n 0 0\n 0 0\n 0 0 0\n 0 0\n 3 0\n 6 3\n",
+			Header{Variables: 3, Constraints: 2, Objectives: 1, Equations: 2, BinaryVariables: 3,
+				JacobianNonzeros: 6, GradientNonzeros: 3},
+			"MILP",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadNLHeader(strings.NewReader(tt.content))
+			if err != nil {
+				t.Fatalf("ReadNLHeader failed with '%v'", err)
+			}
+			if *got != tt.want || got.Class() != tt.class {
+				t.Errorf("got '%+v', '%v', want '%+v', '%v'", *got, got.Class(), tt.want, tt.class)
+			}
+		})
+	}
+}
+
+func TestReadNLHeaderInvalid(t *testing.T) {
+	var tests = []struct {
+		content string
+		want    string
+	}{
+		{"", "not an .nl file"},
+		{"<html><body>Error</body></html>\n", "not an .nl file"},
+		{"gx\n", "not an .nl file"},
+		{"g3 1 1 0\n 10 6 1 2 3\n 4\n", "invalid .nl header on line 3"},
+		{"g3 1 1 0\n 10 6 1 2 3\n", "truncated .nl header on line 3"},
+		{"g3 1 1 0\n 10 six 1 2 3\n", "invalid .nl header on line 2"},
+	}
+	for _, tt := range tests {
+		_, err := ReadNLHeader(strings.NewReader(tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got '%v', want '%v' for '%s'", err, tt.want, tt.content)
+		}
+	}
+}
+
+func TestReadNLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.nl")
+	if err := ioutil.WriteFile(path, []byte(minlpHeader), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := ReadNLFile(path)
+	if err != nil || h.Size != int64(len(minlpHeader)) || h.Discrete() != 4 {
+		t.Errorf("got '%+v', '%v', want size %d", h, err, len(minlpHeader))
+	}
+}
@@ -0,0 +1,312 @@
+package amplfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrEmptySolution is returned by ParseSolution for an empty .sol file.
+var ErrEmptySolution = errors.New("empty .sol file")
+
+// Solution holds the content of an AMPL .sol file.
+type Solution struct {
+	Binary  bool
+	Message string // solve message, one or more lines
+	Options []int  // AMPL options echoed by the solver
+
+	// Numbers of constraints and variables of the problem, followed by the
+	// numbers of dual and primal values in the file, either zero or the same
+	Constraints, Duals, Variables, Primals int
+
+	DualValues, PrimalValues []float64
+
+	// Objective and SolveResult are the objective number and
+	// solve_result_num, -1 when the solver did not report them.
+	Objective, SolveResult int
+}
+
+// Status returns the AMPL solve_result matching s.SolveResult: solved,
+// solved?, infeasible, unbounded, limit, failure or interrupted.
+func (s *Solution) Status() string {
+	return SolveResultStatus(s.SolveResult)
+}
+
+// SolveResultStatus returns the AMPL solve_result for solve_result_num n.
+func SolveResultStatus(n int) string {
+	switch {
+	case n < 0:
+		return "unknown"
+	case n < 100:
+		return "solved"
+	case n < 200:
+		return "solved?"
+	case n < 300:
+		return "infeasible"
+	case n < 400:
+		return "unbounded"
+	case n < 500:
+		return "limit"
+	case n < 600:
+		return "failure"
+	case n < 700:
+		return "interrupted"
+	}
+	return "unknown"
+}
+
+// Summary describes s in one line.
+func (s *Solution) Summary() string {
+	message := strings.TrimSpace(s.Message)
+	if i := strings.IndexByte(message, '\n'); i >= 0 {
+		message = message[:i]
+	}
+	summary := fmt.Sprintf("%s; %d primal and %d dual values", message, s.Primals, s.Duals)
+	if s.SolveResult >= 0 {
+		summary += fmt.Sprintf("; solve_result_num %d (%s)", s.SolveResult, s.Status())
+	}
+	return summary
+}
+
+// WriteTo writes s as a text .sol file. Options must not call for vbtol.
+func (s *Solution) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\nOptions\n%d\n", strings.TrimRight(s.Message, "\n"), len(s.Options))
+	for _, option := range s.Options {
+		fmt.Fprintf(&b, "%d\n", option)
+	}
+	fmt.Fprintf(&b, "%d\n%d\n%d\n%d\n", s.Constraints, len(s.DualValues), s.Variables, len(s.PrimalValues))
+	for _, values := range [][]float64{s.DualValues, s.PrimalValues} {
+		for _, v := range values {
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+		}
+	}
+	if s.SolveResult >= 0 {
+		objective := s.Objective
+		if objective < 0 {
+			objective = 0
+		}
+		fmt.Fprintf(&b, "objno %d %d\n", objective, s.SolveResult)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ParseSolution parses a text or binary .sol file.
+func ParseSolution(data []byte) (*Solution, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, ErrEmptySolution
+	}
+	if len(data) >= 4 {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			if order.Uint32(data) == 6 && bytes.HasPrefix(data[4:], []byte("binary")) {
+				return parseBinarySolution(data, order)
+			}
+		}
+	}
+	return parseTextSolution(data)
+}
+
+// optionCount returns the number of options for the count written at the
+// start of the Options block, which includes vbtol when it follows the counts.
+func optionCount(written int) (n int, vbtol bool, err error) {
+	if written < 0 || written > 100 {
+		return 0, false, fmt.Errorf("invalid .sol file: %d options", written)
+	}
+	if written > 4 {
+		return written - 2, true, nil
+	}
+	return written, false, nil
+}
+
+// counts stores the options and counts read from the Options block, where z
+// holds the number of options as written followed by the other values.
+func (s *Solution) counts(z []int) error {
+	n, _, err := optionCount(z[0])
+	if err != nil {
+		return err
+	}
+	if len(z) < n+5 {
+		return fmt.Errorf("invalid .sol file: truncated Options block")
+	}
+	s.Options = z[1 : n+1]
+	s.Constraints, s.Duals, s.Variables, s.Primals = z[n+1], z[n+2], z[n+3], z[n+4]
+	if s.Duals < 0 || s.Primals < 0 || (s.Duals != 0 && s.Duals != s.Constraints) ||
+		(s.Primals != 0 && s.Primals != s.Variables) {
+		return fmt.Errorf("invalid .sol file: inconsistent counts %d %d %d %d",
+			s.Constraints, s.Duals, s.Variables, s.Primals)
+	}
+	return nil
+}
+
+func parseTextSolution(data []byte) (*Solution, error) {
+	s := &Solution{Objective: -1, SolveResult: -1}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	message := []string{}
+	for {
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("not a .sol file: no Options block")
+		}
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "Options" {
+			break
+		}
+		message = append(message, line)
+	}
+	s.Message = strings.TrimRight(strings.Join(message, "\n"), "\n") + "\n"
+	next := func() (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.ErrUnexpectedEOF
+		}
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+	nextInt := func() (int, error) {
+		text, err := next()
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("invalid .sol file: truncated Options block")
+		} else if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return 0, fmt.Errorf("invalid .sol file: '%s' is not an integer", text)
+		}
+		return n, nil
+	}
+	nopts, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	n, vbtol, err := optionCount(nopts)
+	if err != nil {
+		return nil, err
+	}
+	z := []int{nopts}
+	for i := 0; i < n+4; i++ {
+		v, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		z = append(z, v)
+	}
+	if err := s.counts(z); err != nil {
+		return nil, err
+	}
+	if vbtol {
+		if _, err := next(); err != nil {
+			return nil, fmt.Errorf("invalid .sol file: missing vbtol: %v", err)
+		}
+	}
+	values := func(n int, name string) ([]float64, error) {
+		v := make([]float64, 0, n)
+		for i := 0; i < n; i++ {
+			text, err := next()
+			if err != nil {
+				return nil, fmt.Errorf("invalid .sol file: got %d of %d %s values", i, n, name)
+			}
+			x, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid .sol file: '%s' is not a %s value", text, name)
+			}
+			v = append(v, x)
+		}
+		return v, nil
+	}
+	if s.DualValues, err = values(s.Duals, "dual"); err != nil {
+		return nil, err
+	}
+	if s.PrimalValues, err = values(s.Primals, "primal"); err != nil {
+		return nil, err
+	}
+	if text, err := next(); err == nil && strings.HasPrefix(text, "objno") {
+		if _, err := fmt.Sscanf(text, "objno %d %d", &s.Objective, &s.SolveResult); err != nil {
+			return nil, fmt.Errorf("invalid .sol file: '%s'", text)
+		}
+	}
+	return s, nil
+}
+
+// parseBinarySolution parses a .sol file made of Fortran style records, each
+// preceded and followed by its length: "binary", the lines of the message up
+// to an empty record, the Options block as integers with vbtol as a double
+// after the counts, the dual values, the primal values and optionally the
+// objective number and solve_result_num.
+func parseBinarySolution(data []byte, order binary.ByteOrder) (*Solution, error) {
+	s := &Solution{Binary: true, Objective: -1, SolveResult: -1}
+	next := func() ([]byte, error) {
+		if len(data) < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n := int(order.Uint32(data))
+		if n < 0 || len(data) < n+8 || int(order.Uint32(data[n+4:])) != n {
+			return nil, fmt.Errorf("invalid .sol file: bad record of length %d", n)
+		}
+		record := data[4 : n+4]
+		data = data[n+8:]
+		return record, nil
+	}
+	if _, err := next(); err != nil {
+		return nil, err
+	}
+	message := []string{}
+	for {
+		record, err := next()
+		if err != nil {
+			return nil, fmt.Errorf("invalid .sol file: message: %v", err)
+		}
+		if len(record) == 0 {
+			break
+		}
+		message = append(message, string(record))
+	}
+	s.Message = strings.Join(message, "\n") + "\n"
+	record, err := next()
+	if err != nil {
+		return nil, fmt.Errorf("invalid .sol file: Options block: %v", err)
+	}
+	z := make([]int, len(record)/4)
+	for i := range z {
+		z[i] = int(int32(order.Uint32(record[4*i:])))
+	}
+	if len(z) == 0 {
+		return nil, fmt.Errorf("invalid .sol file: empty Options block")
+	}
+	if err := s.counts(z); err != nil {
+		return nil, err
+	}
+	values := func(n int, name string) ([]float64, error) {
+		if n == 0 {
+			return []float64{}, nil
+		}
+		record, err := next()
+		if err != nil || len(record) != 8*n {
+			return nil, fmt.Errorf("invalid .sol file: want %d %s values", n, name)
+		}
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = math.Float64frombits(order.Uint64(record[8*i:]))
+		}
+		return v, nil
+	}
+	if s.DualValues, err = values(s.Duals, "dual"); err != nil {
+		return nil, err
+	}
+	if s.PrimalValues, err = values(s.Primals, "primal"); err != nil {
+		return nil, err
+	}
+	if record, err := next(); err == nil && len(record) == 8 {
+		s.Objective = int(int32(order.Uint32(record)))
+		s.SolveResult = int(int32(order.Uint32(record[4:])))
+	}
+	return s, nil
+}
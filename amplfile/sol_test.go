@@ -0,0 +1,234 @@
+package amplfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const textSolution = `CPLEX 20.1.0.0: optimal solution; objective 88.2
+1 dual simplex iterations (0 in phase I)
+
+Options
+3
+1
+1
+0
+4
+4
+2
+2
+0
+0.5
+-1
+1e-3
+10
+3.5
+objno 0 0
+suffix 4 2 8 0 0
+sstatus
+0 1
+1 3
+`
+
+func binaryRecord(w *bytes.Buffer, order binary.ByteOrder, data []byte) {
+	_ = binary.Write(w, order, uint32(len(data)))
+	w.Write(data)
+	_ = binary.Write(w, order, uint32(len(data)))
+}
+
+func binarySolution(order binary.ByteOrder, message []string, z []int32, duals, primals []float64, objno []int32) []byte {
+	w := new(bytes.Buffer)
+	binaryRecord(w, order, []byte("binary"))
+	for _, line := range message {
+		binaryRecord(w, order, []byte(line))
+	}
+	binaryRecord(w, order, nil)
+	record := new(bytes.Buffer)
+	_ = binary.Write(record, order, z)
+	binaryRecord(w, order, record.Bytes())
+	for _, values := range [][]float64{duals, primals} {
+		if len(values) > 0 {
+			record := new(bytes.Buffer)
+			_ = binary.Write(record, order, values)
+			binaryRecord(w, order, record.Bytes())
+		}
+	}
+	if objno != nil {
+		record := new(bytes.Buffer)
+		_ = binary.Write(record, order, objno)
+		binaryRecord(w, order, record.Bytes())
+	}
+	return w.Bytes()
+}
+
+func TestParseSolution(t *testing.T) {
+	vbtol := new(bytes.Buffer)
+	_ = binary.Write(vbtol, binary.LittleEndian, []int32{5, 1, 3, 3, 1, 0, 1, 0})
+	_ = binary.Write(vbtol, binary.LittleEndian, math.Float64bits(1e-6))
+	vbtolRecord := vbtol.Bytes()
+	vbtolZ := make([]int32, len(vbtolRecord)/4)
+	_ = binary.Read(bytes.NewReader(vbtolRecord), binary.LittleEndian, vbtolZ)
+
+	var tests = []struct {
+		name string
+		data []byte
+		want Solution
+	}{
+		{
+			"text",
+			[]byte(textSolution),
+			Solution{
+				Message:     "CPLEX 20.1.0.0: optimal solution; objective 88.2\n1 dual simplex iterations (0 in phase I)\n",
+				Options:     []int{1, 1, 0},
+				Constraints: 4, Duals: 4, Variables: 2, Primals: 2,
+				DualValues: []float64{0, 0.5, -1, 1e-3}, PrimalValues: []float64{10, 3.5},
+				Objective: 0, SolveResult: 0,
+			},
+		},
+		{
+			"text without duals and objno",
+			[]byte("Ipopt 3.14: Converged to a locally infeasible point.\n\nOptions\n3\n1\n1\n0\n1\n0\n2\n2\n1\n2\n"),
+			Solution{
+				Message:     "Ipopt 3.14: Converged to a locally infeasible point.\n",
+				Options:     []int{1, 1, 0},
+				Constraints: 1, Variables: 2, Primals: 2,
+				DualValues: []float64{}, PrimalValues: []float64{1, 2},
+				Objective: -1, SolveResult: -1,
+			},
+		},
+		{
+			"text with vbtol",
+			[]byte("msg\n\nOptions\n5\n1\n3\n3\n1\n0\n1\n0\n1e-06\nobjno 0 400\n"),
+			Solution{
+				Message: "msg\n", Options: []int{1, 3, 3}, Constraints: 1, Variables: 1,
+				DualValues: []float64{}, PrimalValues: []float64{}, Objective: 0, SolveResult: 400,
+			},
+		},
+		{
+			"binary",
+			binarySolution(binary.LittleEndian, []string{"Gurobi 9.5: optimal", "2 iterations"},
+				[]int32{3, 1, 1, 0, 1, 1, 2, 2}, []float64{1.5}, []float64{3, 4}, []int32{0, 2}),
+			Solution{
+				Binary: true, Message: "Gurobi 9.5: optimal\n2 iterations\n", Options: []int{1, 1, 0},
+				Constraints: 1, Duals: 1, Variables: 2, Primals: 2,
+				DualValues: []float64{1.5}, PrimalValues: []float64{3, 4}, Objective: 0, SolveResult: 2,
+			},
+		},
+		{
+			"binary big endian",
+			binarySolution(binary.BigEndian, []string{"limit"},
+				[]int32{3, 1, 1, 0, 1, 0, 1, 1}, nil, []float64{7}, []int32{0, 400}),
+			Solution{
+				Binary: true, Message: "limit\n", Options: []int{1, 1, 0},
+				Constraints: 1, Variables: 1, Primals: 1,
+				DualValues: []float64{}, PrimalValues: []float64{7}, Objective: 0, SolveResult: 400,
+			},
+		},
+		{
+			"binary with vbtol",
+			binarySolution(binary.LittleEndian, []string{"msg"}, vbtolZ, nil, nil, nil),
+			Solution{
+				Binary: true, Message: "msg\n", Options: []int{1, 3, 3}, Constraints: 1, Variables: 1,
+				DualValues: []float64{}, PrimalValues: []float64{}, Objective: -1, SolveResult: -1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSolution(tt.data)
+			if err != nil {
+				t.Fatalf("ParseSolution failed with '%v'", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got '%+v', want '%+v'", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSolutionInvalid(t *testing.T) {
+	var tests = []struct {
+		data string
+		want string
+	}{
+		{"", "empty .sol file"},
+		{" \n\n", "empty .sol file"},
+		{"<html><body>502 Bad Gateway</body></html>\n", "not a .sol file"},
+		{"Error: job not found\n", "not a .sol file"},
+		{"msg\n\nOptions\n3\n1\n1\n", "truncated"},
+		{"msg\n\nOptions\n3\n1\n1\n0\n2\n2\n2\n2\n1\n", "got 1 of 2 dual values"},
+		{"msg\n\nOptions\n3\n1\n1\n0\n1\n1\n1\n1\nx\n1\n", "'x' is not a dual value"},
+		{"msg\n\nOptions\n3\n1\n1\n0\n2\n1\n2\n2\n", "inconsistent counts"},
+		{"msg\n\nOptions\n-1\n", "-1 options"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSolution([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got '%v', want '%v' for '%s'", err, tt.want, tt.data)
+		}
+	}
+	truncated := binarySolution(binary.LittleEndian, []string{"msg"}, []int32{3, 1, 1, 0, 1, 1, 1, 1}, []float64{1}, []float64{2}, nil)
+	if _, err := ParseSolution(truncated[:len(truncated)-4]); err == nil {
+		t.Errorf("got '%v', want an error for a truncated binary .sol", err)
+	}
+}
+
+func TestSolutionSummary(t *testing.T) {
+	s, err := ParseSolution([]byte(textSolution))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "CPLEX 20.1.0.0: optimal solution; objective 88.2; 2 primal and 4 dual values; solve_result_num 0 (solved)"
+	if got := s.Summary(); got != want {
+		t.Errorf("got '%v', want '%v'", got, want)
+	}
+	s.SolveResult = -1
+	want = "CPLEX 20.1.0.0: optimal solution; objective 88.2; 2 primal and 4 dual values"
+	if got := s.Summary(); got != want {
+		t.Errorf("got '%v', want '%v'", got, want)
+	}
+}
+
+func TestSolveResultStatus(t *testing.T) {
+	var tests = []struct {
+		n    int
+		want string
+	}{
+		{-1, "unknown"}, {0, "solved"}, {150, "solved?"}, {200, "infeasible"}, {300, "unbounded"},
+		{400, "limit"}, {500, "failure"}, {600, "interrupted"}, {700, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := SolveResultStatus(tt.n); got != tt.want {
+			t.Errorf("got '%v', want '%v' for %d", got, tt.want, tt.n)
+		}
+	}
+}
+
+func TestSolutionWriteTo(t *testing.T) {
+	var tests = []Solution{
+		{Message: "kestrel: NEOS job 1 was killed\n", Options: []int{1, 1, 0}, Constraints: 4, Variables: 6,
+			DualValues: []float64{}, PrimalValues: []float64{}, Objective: 0, SolveResult: 600},
+		{Message: "optimal\nsecond line\n", Options: []int{1, 1, 0}, Constraints: 1, Duals: 1, Variables: 2, Primals: 2,
+			DualValues: []float64{-0.5}, PrimalValues: []float64{1e-20, 3}, Objective: 0, SolveResult: 0},
+		{Message: "no objno\n", Options: []int{}, Constraints: 1, Variables: 1,
+			DualValues: []float64{}, PrimalValues: []float64{}, Objective: -1, SolveResult: -1},
+	}
+	for _, want := range tests {
+		buf := new(bytes.Buffer)
+		n, err := want.WriteTo(buf)
+		if err != nil || n != int64(buf.Len()) {
+			t.Fatalf("got '%v', '%v', want %d bytes", n, err, buf.Len())
+		}
+		got, err := ParseSolution(buf.Bytes())
+		if err != nil {
+			t.Fatalf("ParseSolution failed with '%v' for\n%s", err, buf)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("got '%+v', want '%+v'", *got, want)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// settings lists the options that can also be set in the configuration
+// file, in the order kestrel config show prints them.
+var settings = []string{"email", "neos_server", "neos_username", "neos_user_password", "kestrel_options", "kestrel_redact"}
+
+// defaultSettings holds the built-in values of settings.
+var defaultSettings = map[string]string{
+	"neos_server": "neos-server.org:3333",
+}
+
+// configFile returns the path of the configuration file; tests replace it.
+var configFile = func() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "kestrel", "config.toml")
+}
+
+// profile holds the settings of the selected profile, loaded by loadConfig.
+var profile struct {
+	name     string
+	file     string
+	settings map[string]string
+}
+
+// loadConfig reads the profile selected by the kestrel_profile option, or
+// the default one, from the configuration file. A missing file or default
+// profile is not an error.
+func loadConfig() error {
+	name := getEnvOption("kestrel_profile")
+	explicit := name != ""
+	if !explicit {
+		name = "default"
+	}
+	profile.name, profile.file, profile.settings = name, configFile(), nil
+	if profile.file == "" {
+		return nil
+	}
+	profiles, err := readConfig(profile.file)
+	if errors.Is(err, fs.ErrNotExist) {
+		if explicit {
+			return fmt.Errorf("Error, profile '%s' selected but %s does not exist.", name, profile.file)
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	values, ok := profiles[name]
+	if !ok {
+		if explicit {
+			return fmt.Errorf("Error, no profile '%s' in %s.", name, profile.file)
+		}
+		return nil
+	}
+	for key := range values {
+		if !isSetting(key) {
+			fmt.Printf("Warning, unknown setting '%s' in profile '%s' of %s.\n", key, name, profile.file)
+		}
+	}
+	profile.settings = values
+	return nil
+}
+
+func isSetting(name string) bool {
+	for _, s := range settings {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupSetting returns the effective value of a setting and where it comes
+// from: the AMPL option first, then the selected profile, then the built-in
+// default.
+func lookupSetting(name string) (string, string) {
+	if value := getEnvOption(name); value != "" {
+		return value, "AMPL option"
+	}
+	if value, ok := profile.settings[name]; ok {
+		return value, fmt.Sprintf("profile '%s' in %s", profile.name, profile.file)
+	}
+	if value, ok := defaultSettings[name]; ok {
+		return value, "built-in default"
+	}
+	return "", "unset"
+}
+
+func getSetting(name string) string {
+	value, _ := lookupSetting(name)
+	return value
+}
+
+// readConfig parses the subset of TOML used by the configuration file:
+// [profile] tables holding key = value pairs, where values are strings,
+// numbers or booleans. It returns the settings of each profile.
+func readConfig(fname string) (map[string]map[string]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	profiles := map[string]map[string]string{}
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("Error, %s:%d: %s", fname, n, fmt.Sprintf(format, args...))
+		}
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 || !isComment(line[end+1:]) {
+				return nil, fail("invalid table header")
+			}
+			name, err := tomlKey(strings.TrimSpace(line[1:end]))
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			if _, ok := profiles[name]; ok {
+				return nil, fail("duplicate profile '%s'", name)
+			}
+			current = map[string]string{}
+			profiles[name] = current
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			return nil, fail("expected key = value")
+		}
+		if current == nil {
+			return nil, fail("setting outside of a [profile]")
+		}
+		key, err := tomlKey(strings.TrimSpace(line[:eq]))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		value, err := tomlValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		if _, ok := current[key]; ok {
+			return nil, fail("duplicate key '%s'", key)
+		}
+		current[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// tomlKey returns a bare or quoted key.
+func tomlKey(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		key, rest, err := tomlString(s)
+		if err == nil && rest != "" {
+			err = fmt.Errorf("unexpected '%s' after key", rest)
+		}
+		return key, err
+	}
+	if s == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	for _, r := range s {
+		if !(r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return "", fmt.Errorf("invalid key '%s'", s)
+		}
+	}
+	return s, nil
+}
+
+// tomlValue returns a string value unquoted, or a number or boolean as written.
+func tomlValue(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		value, rest, err := tomlString(s)
+		if err == nil && !isComment(rest) {
+			err = fmt.Errorf("unexpected '%s' after value", rest)
+		}
+		return value, err
+	}
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "true" || s == "false" {
+		return s, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(s, "_", ""), 64); err == nil {
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid value '%s', strings must be quoted", s)
+}
+
+// tomlString parses the basic or literal string at the start of s and
+// returns it with the remainder of s.
+func tomlString(s string) (string, string, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), strings.TrimSpace(s[i+1:]), nil
+		case c == '\\' && quote == '"':
+			i++
+			if i == len(s) {
+				return "", "", fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'u', 'U':
+				size := 4
+				if s[i] == 'U' {
+					size = 8
+				}
+				if i+size >= len(s) {
+					return "", "", fmt.Errorf("invalid escape sequence")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+				if err != nil {
+					return "", "", fmt.Errorf("invalid escape sequence")
+				}
+				b.WriteRune(rune(r))
+				i += size
+			default:
+				return "", "", fmt.Errorf("invalid escape sequence '\\%c'", s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || strings.HasPrefix(s, "#")
+}
+
+// showConfig prints the effective value of each setting and its source.
+func showConfig() (int, error) {
+	fmt.Printf("Configuration file: %s\n", profile.file)
+	fmt.Printf("Profile: %s\n", profile.name)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, name := range settings {
+		value, source := lookupSetting(name)
+		if value == "" {
+			value = "-"
+		} else if name == "neos_user_password" {
+			value = redactedPassword
+		} else if name == "kestrel_options" && redactPasswords() {
+			value = redactOptions(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, value, source)
+	}
+	w.Flush()
+	if getSetting("neos_username") == "" {
+		host, _ := getNEOSServer()
+		if username, _ := storedCredentials(host); username != "" {
+			fmt.Printf("Using the credentials of %s stored for %s in %s\n", username, host, credentialsFile())
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig makes fname the configuration file for the duration of the test.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	fname := filepath.Join(t.TempDir(), "config.toml")
+	if err := ioutil.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := configFile
+	configFile = func() string { return fname }
+	t.Cleanup(func() {
+		configFile = file
+		unsetEnv("kestrel_profile", "email", "neos_server")
+		_ = loadConfig()
+	})
+	return fname
+}
+
+func TestReadConfig(t *testing.T) {
+	fname := writeConfig(t, `# kestrel settings
+[default]
+email = "me@example.com"   # comment
+neos_server = 'localhost:3333'
+
+[work]
+"email" = "me@work.com"
+kestrel_options = "priority=long timeout=60"
+retries = 3
+`)
+	profiles, err := readConfig(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		"default": {"email": "me@example.com", "neos_server": "localhost:3333"},
+		"work":    {"email": "me@work.com", "kestrel_options": "priority=long timeout=60", "retries": "3"},
+	}
+	if !reflect.DeepEqual(profiles, want) {
+		t.Errorf("got '%v', want '%v'", profiles, want)
+	}
+}
+
+func TestReadConfigErrors(t *testing.T) {
+	var tests = []struct {
+		content string
+		err     string
+	}{
+		{"email = \"me@example.com\"\n", ":1: setting outside of a [profile]"},
+		{"[default\n", ":1: invalid table header"},
+		{"[default]\nemail\n", ":2: expected key = value"},
+		{"[default]\nemail = me@example.com\n", ":2: invalid value 'me@example.com', strings must be quoted"},
+		{"[default]\nemail = \"me@example.com\n", ":2: unterminated string"},
+		{"[default]\nemail = \"a\" \"b\"\n", ":2: unexpected '\"b\"' after value"},
+		{"[default]\nemail = \"a\"\nemail = \"b\"\n", ":3: duplicate key 'email'"},
+		{"[default]\n[default]\n", ":2: duplicate profile 'default'"},
+		{"[default]\nbad key = 1\n", ":2: invalid key 'bad key'"},
+	}
+	for i, tt := range tests {
+		testname := fmt.Sprintf("test #%d", i)
+		t.Run(testname, func(t *testing.T) {
+			fname := writeConfig(t, tt.content)
+			_, err := readConfig(fname)
+			if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+				t.Errorf("got '%v', want '%v'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLookupSetting(t *testing.T) {
+	fname := writeConfig(t, `[default]
+email = "me@example.com"
+
+[work]
+email = "me@work.com"
+neos_server = "neos.work.com"
+`)
+	var tests = []struct {
+		profile string
+		env     string
+		name    string
+		value   string
+		source  string
+	}{
+		{"", "", "email", "me@example.com", "profile 'default' in " + fname},
+		{"work", "", "email", "me@work.com", "profile 'work' in " + fname},
+		{"work", "me@home.com", "email", "me@home.com", "AMPL option"},
+		{"work", "", "neos_server", "neos.work.com", "profile 'work' in " + fname},
+		{"", "", "neos_server", "neos-server.org:3333", "built-in default"},
+		{"", "", "neos_username", "", "unset"},
+	}
+	for i, tt := range tests {
+		testname := fmt.Sprintf("test #%d", i)
+		t.Run(testname, func(t *testing.T) {
+			os.Setenv("kestrel_profile", tt.profile)
+			if tt.env != "" {
+				os.Setenv(tt.name, tt.env)
+			}
+			err := loadConfig()
+			value, source := lookupSetting(tt.name)
+			unsetEnv("kestrel_profile", tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != tt.value || source != tt.source {
+				t.Errorf("got '%v', '%v', want '%v', '%v'", value, source, tt.value, tt.source)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingProfile(t *testing.T) {
+	fname := writeConfig(t, "[default]\nemail = \"me@example.com\"\n")
+	os.Setenv("kestrel_profile", "work")
+	err := loadConfig()
+	want := fmt.Sprintf("Error, no profile 'work' in %s.", fname)
+	if err == nil || err.Error() != want {
+		t.Errorf("got '%v', want '%v'", err, want)
+	}
+	exit, err := run([]string{"kestrel", "config", "show"})
+	if exit != 1 || err == nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 1)
+	}
+	// The version is printed regardless
+	for _, arg := range []string{"-v", "version"} {
+		exit, err = run([]string{"kestrel", arg})
+		if exit != 0 || err != nil {
+			t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+		}
+	}
+
+	// Without a configuration file only the default profile may be used
+	configFile = func() string { return filepath.Join(t.TempDir(), "config.toml") }
+	if err := loadConfig(); err == nil {
+		t.Errorf("got '%v', want an error", err)
+	}
+	unsetEnv("kestrel_profile")
+	if err := loadConfig(); err != nil {
+		t.Errorf("got '%v', want '%v'", err, nil)
+	}
+}
+
+func TestRunConfigShow(t *testing.T) {
+	writeConfig(t, "[default]\nemail = \"me@example.com\"\nneos_user_password = \"secret\"\n")
+	exit, err := run([]string{"kestrel", "config", "show"})
+	if exit != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	if email := getEmail(); email != "me@example.com" {
+		t.Errorf("got '%v', want '%v'", email, "me@example.com")
+	}
+	exit, err = run([]string{"kestrel", "config"})
+	if exit != 1 || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 1)
+	}
+}
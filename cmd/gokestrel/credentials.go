@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// credential is a NEOS account stored for a server host.
+type credential struct {
+	Machine, Login, Password string
+}
+
+// input is where kestrel login reads the username and password; tests
+// replace it.
+var input = bufio.NewReader(os.Stdin)
+
+// credentialsFile returns the path of the file kestrel login writes, next to
+// the configuration file.
+func credentialsFile() string {
+	config := configFile()
+	if config == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(config), "credentials")
+}
+
+// readCredentials parses a netrc style file made of "machine HOST login USER
+// password PASSWORD" entries. Tokens containing spaces or quotes are quoted.
+func readCredentials(fname string) ([]credential, error) {
+	content, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := netrcTokens(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("Error, %s: %v", fname, err)
+	}
+	credentials := []credential{}
+	for i := 0; i < len(tokens); i += 2 {
+		if i+1 == len(tokens) {
+			return nil, fmt.Errorf("Error, %s: missing value for '%s'", fname, tokens[i])
+		}
+		key, value := tokens[i], tokens[i+1]
+		if key == "machine" {
+			credentials = append(credentials, credential{Machine: value})
+			continue
+		}
+		if len(credentials) == 0 {
+			return nil, fmt.Errorf("Error, %s: '%s' before machine", fname, key)
+		}
+		c := &credentials[len(credentials)-1]
+		switch key {
+		case "login":
+			c.Login = value
+		case "password":
+			c.Password = value
+		}
+	}
+	return credentials, nil
+}
+
+func netrcTokens(s string) ([]string, error) {
+	tokens := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		for line != "" && !strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, `"`) {
+				end := 1
+				for end < len(line) && line[end] != '"' {
+					if line[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(line) {
+					return nil, fmt.Errorf("unterminated quoted token %s", line)
+				}
+				token, err := strconv.Unquote(line[:end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid quoted token %s", line[:end+1])
+				}
+				tokens = append(tokens, token)
+				line = line[end+1:]
+			} else {
+				end := strings.IndexAny(line, " \t")
+				if end < 0 {
+					end = len(line)
+				}
+				tokens = append(tokens, line[:end])
+				line = line[end:]
+			}
+			line = strings.TrimSpace(line)
+		}
+	}
+	return tokens, nil
+}
+
+func netrcToken(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"#\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func writeCredentials(fname string, credentials []credential) error {
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, c := range credentials {
+		fmt.Fprintf(&b, "machine %s login %s password %s\n",
+			netrcToken(c.Machine), netrcToken(c.Login), netrcToken(c.Password))
+	}
+	return writeFileAtomic(fname, []byte(b.String()), 0600)
+}
+
+// storedCredentials returns the username and password saved by kestrel login
+// for host, if any.
+func storedCredentials(host string) (string, string) {
+	fname := credentialsFile()
+	if fname == "" {
+		return "", ""
+	}
+	credentials, err := readCredentials(fname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ""
+	} else if err != nil {
+		fmt.Printf("Warning, could not read stored credentials: %v\n", err)
+		return "", ""
+	}
+	for _, c := range credentials {
+		if c.Machine == host {
+			if info, err := os.Stat(fname); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+				fmt.Printf("Warning, %s is accessible by other users, run: chmod 600 %s\n", fname, fname)
+			}
+			return c.Login, c.Password
+		}
+	}
+	return "", ""
+}
+
+func readLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := input.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimSpace(line), err
+}
+
+// readPassword is readLine with the terminal echo turned off when possible.
+func readPassword(prompt string) (string, error) {
+	if err := setEcho(false); err == nil {
+		defer func() {
+			setEcho(true)
+			fmt.Println()
+		}()
+	}
+	return readLine(prompt)
+}
+
+// login asks for a NEOS username and password and stores them for the host
+// selected by neos_server.
+func login() (int, error) {
+	host, _ := getNEOSServer()
+	fname := credentialsFile()
+	if fname == "" {
+		return 1, fmt.Errorf("Error, no configuration directory to store credentials in.")
+	}
+	username, err := readLine(fmt.Sprintf("NEOS username for %s: ", host))
+	if err != nil {
+		return 1, err
+	}
+	password, err := readPassword("NEOS password: ")
+	if err != nil {
+		return 1, err
+	}
+	if username == "" || password == "" {
+		return 1, fmt.Errorf("Error, a username and a password are required.")
+	}
+	credentials, err := readCredentials(fname)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 1, err
+	}
+	entry := credential{Machine: host, Login: username, Password: password}
+	replaced := false
+	for i, c := range credentials {
+		if c.Machine == host {
+			credentials[i], replaced = entry, true
+		}
+	}
+	if !replaced {
+		credentials = append(credentials, entry)
+	}
+	if err := writeCredentials(fname, credentials); err != nil {
+		return 1, err
+	}
+	fmt.Printf("Credentials for %s saved to %s\n", host, fname)
+	return 0, nil
+}
+
+// logout removes the credentials stored for the host selected by neos_server.
+func logout() (int, error) {
+	host, _ := getNEOSServer()
+	fname := credentialsFile()
+	if fname == "" {
+		fmt.Printf("No credentials stored for %s\n", host)
+		return 0, nil
+	}
+	credentials, err := readCredentials(fname)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 1, err
+	}
+	kept := []credential{}
+	for _, c := range credentials {
+		if c.Machine != host {
+			kept = append(kept, c)
+		}
+	}
+	if len(kept) == len(credentials) {
+		fmt.Printf("No credentials stored for %s\n", host)
+		return 0, nil
+	}
+	if len(kept) == 0 {
+		err = os.Remove(fname)
+	} else {
+		err = writeCredentials(fname, kept)
+	}
+	if err != nil {
+		return 1, err
+	}
+	fmt.Printf("Credentials for %s removed from %s\n", host, fname)
+	return 0, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// typeInput makes lines the input read by kestrel login.
+func typeInput(t *testing.T, lines ...string) {
+	t.Helper()
+	in := input
+	input = bufio.NewReader(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+	t.Cleanup(func() { input = in })
+}
+
+func TestCredentialsRoundTrip(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "kestrel", "credentials")
+	credentials := []credential{
+		{"neos-server.org", "user", "secret"},
+		{"localhost", "other user", `p"a#s\s w`},
+	}
+	if err := writeCredentials(fname, credentials); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 && os.PathSeparator == '/' {
+		t.Errorf("got '%v', want '%v'", perm, os.FileMode(0600))
+	}
+	got, err := readCredentials(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, credentials) {
+		t.Errorf("got '%v', want '%v'", got, credentials)
+	}
+}
+
+func TestReadCredentialsErrors(t *testing.T) {
+	for _, content := range []string{"login user\n", "machine host login\n", "machine host login \"user\n"} {
+		fname := filepath.Join(t.TempDir(), "credentials")
+		if err := os.WriteFile(fname, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readCredentials(fname); err == nil {
+			t.Errorf("got '%v' for %q, want an error", err, content)
+		}
+	}
+}
+
+func TestRunLoginLogout(t *testing.T) {
+	writeConfig(t, "")
+	defer unsetEnv("neos_server", "neos_username", "neos_user_password")
+	os.Setenv("neos_server", "localhost:3333")
+	typeInput(t, "user", "secret")
+	exit, err := run([]string{"kestrel", "login"})
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	if username, password := getAuthenticationOptions(); username != "user" || password != "secret" {
+		t.Errorf("got '%v', '%v', want '%v', '%v'", username, password, "user", "secret")
+	}
+	// AMPL options take precedence
+	os.Setenv("neos_username", "other")
+	os.Setenv("neos_user_password", "password")
+	if username, password := getAuthenticationOptions(); username != "other" || password != "password" {
+		t.Errorf("got '%v', '%v', want '%v', '%v'", username, password, "other", "password")
+	}
+	unsetEnv("neos_username", "neos_user_password")
+
+	// Logging in again replaces the credentials of the host only
+	os.Setenv("neos_server", "neos-server.org")
+	typeInput(t, "neos", "neos")
+	if exit, err := run([]string{"kestrel", "login"}); exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	os.Setenv("neos_server", "localhost:3333")
+	typeInput(t, "user", "changed")
+	if exit, err := run([]string{"kestrel", "login"}); exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	credentials, err := readCredentials(credentialsFile())
+	want := []credential{{"localhost", "user", "changed"}, {"neos-server.org", "neos", "neos"}}
+	if err != nil || !reflect.DeepEqual(credentials, want) {
+		t.Errorf("got '%v', '%v', want '%v'", credentials, err, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		exit, err = run([]string{"kestrel", "logout"})
+		if exit != 0 || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+		}
+		if username, password := getAuthenticationOptions(); username != "" || password != "" {
+			t.Errorf("got '%v', '%v', want no credentials", username, password)
+		}
+	}
+	os.Setenv("neos_server", "neos-server.org")
+	if exit, err := run([]string{"kestrel", "logout"}); exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	if _, err := os.Stat(credentialsFile()); !os.IsNotExist(err) {
+		t.Errorf("got '%v', want the credentials file removed", err)
+	}
+}
+
+func TestRunLoginMissingPassword(t *testing.T) {
+	writeConfig(t, "")
+	typeInput(t, "user", "")
+	exit, err := run([]string{"kestrel", "login"})
+	if exit != 1 || err == nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 1)
+	}
+}
+
+func TestFakeAuthenticatedStored(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Users["user"] = "secret"
+	writeConfig(t, "")
+	typeInput(t, "user", "secret")
+	if exit, err := run([]string{"kestrel", "login"}); exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	exit, err := solve(context.Background(), stub)
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if job := srv.Job(1001); job == nil || job.User != "user" {
+		t.Errorf("got '%v', want '%v'", job, "user")
+	}
+}
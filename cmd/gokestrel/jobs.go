@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Job is a record of the session job queue kept by kestrel submit.
+type Job struct {
+	Number    int       `json:"job"`
+	Password  string    `json:"password"`
+	Stub      string    `json:"stub,omitempty"`
+	Solver    string    `json:"solver,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+	Submitted time.Time `json:"submitted"`
+	Server    string    `json:"server,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Name      string    `json:"name,omitempty"`
+}
+
+// lockTimeout bounds the wait for another kestrel process to release the
+// jobs file; locks older than lockStale are left over by a crashed process.
+var (
+	lockTimeout = 10 * time.Second
+	lockStale   = time.Minute
+)
+
+func jobsFile() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("at%s.json", getEnvOption("ampl_id")))
+}
+
+// legacyJobsFile is the "jobnumber password" text file used by earlier versions.
+func legacyJobsFile(jobsFile string) string {
+	return strings.TrimSuffix(jobsFile, ".json") + ".jobs"
+}
+
+// lockJobs acquires the lock guarding jobsFile and returns the function
+// releasing it.
+func lockJobs(jobsFile string) (func(), error) {
+	lock := jobsFile + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("Error, %s is locked by another kestrel process.", jobsFile)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// listJobs returns the jobs queued in jobsFile, oldest first.
+func listJobs(jobsFile string) ([]Job, error) {
+	unlock, err := lockJobs(jobsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return readJobs(jobsFile)
+}
+
+// updateJobs replaces the jobs queued in jobsFile with the result of update,
+// holding the lock throughout so that concurrent sessions do not interleave.
+func updateJobs(jobsFile string, update func([]Job) ([]Job, error)) error {
+	unlock, err := lockJobs(jobsFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	jobs, err := readJobs(jobsFile)
+	if err != nil {
+		return err
+	}
+	jobs, err = update(jobs)
+	if err != nil {
+		return err
+	}
+	if err := writeJobs(jobs, jobsFile); err != nil {
+		return err
+	}
+	// The jobs of the legacy file, if any, have been migrated
+	if err := os.Remove(legacyJobsFile(jobsFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// findJob returns the index of the job with the given number, or of the
+// oldest job with the given name, or 0 when neither is set. It returns -1
+// when there is no such job.
+func findJob(jobs []Job, jobNumber int, name string) int {
+	for i, job := range jobs {
+		if (jobNumber == 0 && name == "") || (jobNumber != 0 && job.Number == jobNumber) ||
+			(jobNumber == 0 && name != "" && job.Name == name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeJob removes the job with the given number from jobsFile.
+func removeJob(jobsFile string, jobNumber int) error {
+	return updateJobs(jobsFile, func(jobs []Job) ([]Job, error) {
+		for i := range jobs {
+			if jobs[i].Number == jobNumber {
+				return append(jobs[:i], jobs[i+1:]...), nil
+			}
+		}
+		return jobs, nil
+	})
+}
+
+func readJobs(jobsFile string) ([]Job, error) {
+	content, err := ioutil.ReadFile(jobsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return readLegacyJobs(legacyJobsFile(jobsFile))
+	} else if err != nil {
+		return nil, err
+	}
+	jobs := []Job{}
+	if err := json.Unmarshal(content, &jobs); err != nil {
+		return nil, fmt.Errorf("Error, could not read %s: %v", jobsFile, err)
+	}
+	return jobs, nil
+}
+
+func readLegacyJobs(jobsFile string) ([]Job, error) {
+	f, err := os.Open(jobsFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	jobs := []Job{}
+	for {
+		job := Job{}
+		_, err := fmt.Fscanf(f, "%d %s\n", &job.Number, &job.Password)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// writeJobs atomically replaces jobsFile, which is removed when jobs is empty.
+func writeJobs(jobs []Job, jobsFile string) error {
+	if len(jobs) == 0 {
+		if err := os.Remove(jobsFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	content, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(jobsFile, append(content, '\n'), 0600)
+}
+
+// writeFileAtomic replaces fname with content through a temporary file, so
+// that readers never see a partially written file.
+func writeFileAtomic(fname string, content []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(fname), filepath.Base(fname)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fname)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// printJobs prints jobs as a table, with ages relative to now.
+func printJobs(jobs []Job, now time.Time) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSOLVER\tSTATUS\tAGE")
+	for _, job := range jobs {
+		solver, age := job.Solver, "-"
+		if solver == "" {
+			solver = "-"
+		}
+		if !job.Submitted.IsZero() {
+			age = formatAge(now.Sub(job.Submitted))
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", job.Number, solver, job.Status, age)
+	}
+	w.Flush()
+}
+
+// formatAge formats d with its two most significant units, e.g. "2h13m".
+func formatAge(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	seconds := int(d.Seconds()) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm%ds", minutes, seconds)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLegacyJobsMigration(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "at123.json")
+	legacy := legacyJobsFile(fname)
+	if err := ioutil.WriteFile(legacy, []byte("2746671 AnVsgUKc\n2746672 bWsgUKcA\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := listJobs(fname)
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("got '%v', '%v', want 2 jobs", jobs, err)
+	}
+	if jobs[1].Number != 2746672 || jobs[1].Password != "bWsgUKcA" {
+		t.Errorf("got '%v', want 2746672 bWsgUKcA", jobs[1])
+	}
+	err = updateJobs(fname, func(jobs []Job) ([]Job, error) {
+		return append(jobs, Job{Number: 3, Password: "x", Stub: "kmodel"}), nil
+	})
+	if err != nil {
+		t.Fatalf("updateJobs failed with '%v'", err)
+	}
+	if _, err := os.Stat(legacy); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%s was not removed: '%v'", legacy, err)
+	}
+	jobs, err = listJobs(fname)
+	if err != nil || len(jobs) != 3 || jobs[2].Stub != "kmodel" {
+		t.Errorf("got '%v', '%v', want 3 jobs", jobs, err)
+	}
+}
+
+func TestUpdateJobsConcurrently(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "at123.json")
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			err := updateJobs(fname, func(jobs []Job) ([]Job, error) {
+				return append(jobs, Job{Number: n, Password: "x"}), nil
+			})
+			if err != nil {
+				t.Errorf("updateJobs failed with '%v'", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	jobs, err := listJobs(fname)
+	if err != nil || len(jobs) != 20 {
+		t.Errorf("got %d jobs, '%v', want 20", len(jobs), err)
+	}
+}
+
+func TestUpdateJobsEmpty(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "at123.json")
+	for _, jobs := range [][]Job{{{Number: 1}}, nil} {
+		err := updateJobs(fname, func([]Job) ([]Job, error) {
+			return jobs, nil
+		})
+		if err != nil {
+			t.Fatalf("updateJobs failed with '%v'", err)
+		}
+	}
+	if _, err := os.Stat(fname); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%s was not removed: '%v'", fname, err)
+	}
+	if jobs, err := listJobs(fname); len(jobs) != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want no jobs", jobs, err)
+	}
+}
+
+func TestLockJobs(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "at123.json")
+	timeout := lockTimeout
+	lockTimeout = 100 * time.Millisecond
+	defer func() { lockTimeout = timeout }()
+	unlock, err := lockJobs(fname)
+	if err != nil {
+		t.Fatalf("lockJobs failed with '%v'", err)
+	}
+	if _, err := listJobs(fname); err == nil {
+		t.Errorf("listJobs succeeded while the jobs file was locked")
+	}
+	unlock()
+	if _, err := listJobs(fname); err != nil {
+		t.Errorf("listJobs failed with '%v'", err)
+	}
+	// A lock left over by a crashed process is taken over
+	if _, err := lockJobs(fname); err != nil {
+		t.Fatalf("lockJobs failed with '%v'", err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(fname+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listJobs(fname); err != nil {
+		t.Errorf("listJobs failed with '%v'", err)
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	var tests = []struct {
+		age  time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{42 * time.Second, "42s"},
+		{5*time.Minute + 3*time.Second, "5m3s"},
+		{2*time.Hour + 13*time.Minute + 59*time.Second, "2h13m"},
+		{76 * time.Hour, "3d4h"},
+	}
+	for _, tt := range tests {
+		if got := formatAge(tt.age); got != tt.want {
+			t.Errorf("formatAge(%v) = '%v', want '%v'", tt.age, got, tt.want)
+		}
+	}
+}
@@ -1,104 +1,92 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
 	"hash/fnv"
-	"io"
-	"io/ioutil"
+	"net/http"
 	"os"
-	"path"
-	"regexp"
+	"path/filepath"
 	"strings"
+	"time"
 
-	"alexejk.io/go-xmlrpc"
+	"ampl/gokestrel/amplfile"
+	"ampl/gokestrel/neos/kestrel"
 )
 
 type Kestrel struct {
-	Host, Port             string
-	Username, UserPassword string
-	Email                  string
-	Client                 *xmlrpc.Client
+	*kestrel.Client
+	Email string
 }
 
-func NewKestrel() (*Kestrel, error) {
-	host, port := getNEOSServer()
-	username, password := getAuthenticationOptions()
+// retryPolicy applies to the NEOS calls that can safely be repeated.
+var retryPolicy = kestrel.DefaultRetryPolicy
+
+// httpClient is used for NEOS requests when set; tests point it at a
+// neostest.Server so that its certificate is trusted.
+var httpClient *http.Client
+
+func NewKestrel(ctx context.Context) (*Kestrel, error) {
 	email := getEmail()
 	if email == "" {
 		return nil, fmt.Errorf("An email address is required for NEOS submissions.\n" +
 			"To set: option email \"<address>\";\n\n")
 	}
-	fmt.Printf("Connecting to: %s:%s\n", host, port)
-	client, err := xmlrpc.NewClient(fmt.Sprintf("https://%s:%s", host, port))
-	if err == nil {
-		err = client.Call("ping", nil, nil)
-	}
+	client, err := connect(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("Error, NEOS solver is temporarily unavailable. Error: %v", err)
+		return nil, err
 	}
 	return &Kestrel{
-		Host:         host,
-		Port:         port,
-		Username:     username,
-		UserPassword: password,
-		Email:        email,
-		Client:       client,
+		Client: client,
+		Email:  email,
 	}, nil
 }
 
-func (k *Kestrel) submit(xml string) (int, string, error) {
+// connect returns a client for the NEOS server selected by the neos_server
+// option, for commands that do not submit jobs.
+func connect(ctx context.Context) (*kestrel.Client, error) {
+	host, port := getNEOSServer()
+	username, password := getAuthenticationOptions()
 	hostname, err := os.Hostname()
 	if err != nil {
-		return 0, "", err
-	}
-	user := fmt.Sprintf("%s on %s", getEnvOption("LOGNAME"), hostname)
-	result := struct {
-		Results []interface{}
-	}{}
-	if k.Username == "" || k.UserPassword == "" {
-		request := struct {
-			Xml     string
-			User    string
-			Kestrel string
-		}{xml, user, "kestrel"}
-		if err := k.Client.Call("submitJob", &request, &result); err != nil {
-			return 0, "", err
-		}
-	} else {
-		request := struct {
-			Xml      string
-			Username string
-			Password string
-			Kestrel  string
-		}{xml, k.Username, k.UserPassword, "kestrel"}
-		if err := k.Client.Call("authenticatedSubmitJob", &request, &result); err != nil {
-			return 0, "", err
-		}
-	}
-	var jobNumber int
-	if len(result.Results) == 2 {
-		if v, ok := result.Results[0].(int); ok {
-			jobNumber = v
-		}
-	}
-	if jobNumber == 0 {
-		return 0, "", fmt.Errorf("Error: %v\nJob not submitted.\n", result.Results[1])
+		return nil, err
 	}
+	fmt.Printf("Connecting to: %s:%s\n", host, port)
+	timeout := getTimeout()
+	retry := retryPolicy
+	retry.OnRetry = func(err error, attempt int, delay time.Duration) {
+		fmt.Printf("NEOS call failed: %v\n", err)
+		fmt.Printf("Retrying in %.1fs (%d/%d)\n", delay.Seconds(), attempt, retry.MaxAttempts-1)
+	}
+	client, err := kestrel.NewClient(ctx, kestrel.Config{
+		Host:           host,
+		Port:           port,
+		Username:       username,
+		UserPassword:   password,
+		User:           fmt.Sprintf("%s on %s", getEnvOption("LOGNAME"), hostname),
+		HTTPClient:     httpClient,
+		ConnectTimeout: timeout,
+		Timeout:        timeout,
+		Retry:          retry,
+	})
+	if errors.Is(err, kestrel.ErrUnavailable) {
+		return nil, fmt.Errorf("Error, %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
 
-	password := ""
-	if v, ok := result.Results[1].(string); ok {
-		password = v
+func (k *Kestrel) submit(ctx context.Context, submission *kestrel.Submission) (int, string, error) {
+	job, err := k.Submit(ctx, submission)
+	if err != nil {
+		return 0, "", err
 	}
-	fmt.Printf("Job %d submitted to NEOS, password='%s'\n", jobNumber, password)
+	fmt.Printf("Job %d submitted to NEOS, password='%s'\n", job.Number, redacted(job.Password))
 	fmt.Printf("Check the following URL for progress report:\n")
-	fmt.Printf(
-		"https://%s/neos/cgi-bin/nph-neos-solver.cgi?admin=results&jobnumber=%d&pass=%s\n",
-		k.Host, jobNumber, password)
-
-	return jobNumber, password, nil
+	fmt.Println(k.ResultsURL(kestrel.Job{Number: job.Number, Password: redacted(job.Password)}))
+	return job.Number, job.Password, nil
 }
 
 var SolValidationEnv = ""
@@ -118,204 +106,315 @@ func writeSolutionValidationFile(solFile string, size int) error {
 	return nil
 }
 
-func (k *Kestrel) retrieve(stub string, jobNumber int, password string) error {
-	stub = strings.TrimSuffix(stub, ".nl") + ".sol"
-	request := struct {
-		JobNumber int
-		Password  string
-	}{jobNumber, password}
-	result := struct {
-		Solution string
-	}{}
-	if err := k.Client.Call("getFinalResults", &request, &result); err != nil {
-		return err
+// Exit codes for jobs retrieved without a solution, one per outcome so that
+// scripts can tell them apart. Exit code 1 means the job was not retrieved.
+const (
+	exitNoSolution   = 2 // the job completed normally without a valid solution
+	exitKilled       = 3
+	exitOutOfMemory  = 4
+	exitTimedOut     = 5
+	exitDisconnected = 6
+	exitSystemError  = 7
+)
+
+// outcome is how a job that returned no solution ended.
+type outcome struct {
+	exitCode    int
+	solveResult int // solve_result_num written to the .sol file
+	reason      string
+}
+
+// retrieve writes the solution of a job to stub and returns 0, or writes a
+// .sol file without values and returns the exit code of the outcome when the
+// job did not end with a solution. A non-nil error comes with exit code 1.
+// The output files listed in kestrel_options are then fetched next to stub.
+func (k *Kestrel) retrieve(ctx context.Context, stub string, jobNumber int, password string, force bool) (int, error) {
+	exit, err := k.retrieveSolution(ctx, stub, jobNumber, password, force)
+	if err == nil {
+		// Failures are reported as warnings, the solution is what matters
+		_ = k.fetchOutputs(ctx, stub, kestrel.Job{Number: jobNumber, Password: password},
+			getKestrelOptions().OutputFiles())
 	}
-	size, err := writeToFile(result.Solution, stub)
+	return exit, err
+}
+
+func (k *Kestrel) retrieveSolution(ctx context.Context, stub string, jobNumber int, password string, force bool) (int, error) {
+	job := kestrel.Job{Number: jobNumber, Password: password}
+	info, err := k.JobInfo(ctx, job)
 	if err != nil {
-		return err
+		return 1, err
 	}
-	if SolValidationEnv != "" {
-		return writeSolutionValidationFile(stub, size)
+	if info.Status == kestrel.StatusUnknownJob || info.Status == kestrel.StatusBadPassword {
+		return 1, fmt.Errorf("Error, job %d: %s", jobNumber, info.Status)
+	}
+	var solution string
+	if info.Status == kestrel.StatusDone {
+		solution, err = k.FinalResultsNonBlocking(ctx, job)
+	} else {
+		// Wait for the job to finish
+		solution, err = k.FinalResults(ctx, job)
 	}
-	return nil
-}
-
-func (k *Kestrel) kill(jobNumber int, password string) error {
-	request := struct {
-		JobNumber int
-		Password  string
-	}{jobNumber, password}
-	result := struct {
-		Response string
-	}{}
-	err := k.Client.Call("killJob", &request, &result)
 	if err != nil {
-		return err
+		return 1, err
 	}
-	fmt.Println(result.Response)
-	return nil
+	code, err := k.CompletionCode(ctx, job)
+	if ctx.Err() != nil {
+		return 1, ctx.Err()
+	} else if err != nil {
+		fmt.Printf("Warning, could not get the completion code of job %d: %v\n", jobNumber, err)
+	}
+	if o, failed := completionOutcome(code); failed {
+		return o.exitCode, writeFailure(stub, jobNumber, info, o)
+	}
+	sol, err := amplfile.ParseSolution([]byte(solution))
+	if err != nil {
+		o := failureReason(solution, err)
+		return o.exitCode, writeFailure(stub, jobNumber, info, o)
+	}
+	fmt.Printf("Solution: %s\n", sol.Summary())
+	if err := checkDimensions(stub, jobNumber, sol); err != nil {
+		if !force {
+			return 1, err
+		}
+		fmt.Printf("Warning, %v\n", strings.TrimPrefix(err.Error(), "Error, "))
+	}
+	if err := writeSolution(solution, stub); err != nil {
+		return 1, err
+	}
+	return 0, nil
 }
 
-func (k *Kestrel) getIntermediateResults(jobNumber int, password string, offset int) (string, int, error) {
-	request := struct {
-		JobNumber int
-		Password  string
-		Offset    int
-	}{jobNumber, password, offset}
-	result := struct {
-		Results []interface{}
-	}{}
-	if err := k.Client.Call("getIntermediateResults", &request, &result); err != nil {
-		return "", 0, err
-	}
-	output := ""
-	if len(result.Results) == 2 {
-		if v, ok := result.Results[0].([]byte); ok {
-			output = string(v)
+// fetchOutputs downloads the named output files of a finished job into the
+// directory of stub. Every file is tried, failures are printed as warnings
+// and counted in the returned error.
+func (k *Kestrel) fetchOutputs(ctx context.Context, stub string, job kestrel.Job, names []string) error {
+	failed := 0
+	for _, name := range names {
+		content, err := k.OutputFile(ctx, job, name)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fname := filepath.Join(filepath.Dir(stub), name)
+		if err == nil {
+			err = writeFileAtomic(fname, content, 0644)
 		}
-		if v, ok := result.Results[1].(int); ok {
-			offset = v
+		if err != nil {
+			fmt.Printf("Warning, could not fetch %s of job %d: %v\n", name, job.Number, err)
+			failed++
+			continue
 		}
+		fmt.Printf("Output file %s written to %s\n", name, fname)
 	}
-	return output, offset, nil
+	if failed > 0 {
+		return fmt.Errorf("Error, could not fetch %d of %d output files of job %d.", failed, len(names), job.Number)
+	}
+	return nil
 }
 
-func (k *Kestrel) getJobStatus(jobNumber int, password string) (string, error) {
-	request := struct {
-		JobNumber int
-		Password  string
-	}{jobNumber, password}
-	result := struct {
-		Status string
-	}{}
-	if err := k.Client.Call("getJobStatus", &request, &result); err != nil {
-		return "", err
+// writeFailure reports the outcome of a job without a solution and lets AMPL
+// report it through solve_result.
+func writeFailure(stub string, jobNumber int, info kestrel.JobInfo, o outcome) error {
+	solver := ""
+	if info.Solver != "" {
+		solver = fmt.Sprintf(" (%s)", info.Solver)
 	}
-	return result.Status, nil
+	fmt.Printf("Error, NEOS job %d%s %s\n", jobNumber, solver, o.reason)
+	return writeFailureSolution(stub, o.solveResult, fmt.Sprintf("kestrel: NEOS job %d %s", jobNumber, o.reason))
 }
 
-var solverRgx = regexp.MustCompile(`(?i)solver\s*=*\s*(\S+)`)
+// completionOutcome returns the outcome of a job that NEOS did not complete
+// normally, or false when it did.
+func completionOutcome(code kestrel.CompletionCode) (outcome, bool) {
+	switch code {
+	case kestrel.CompletionNormal, "":
+		return outcome{}, false
+	case kestrel.CompletionOutOfMemory:
+		return outcome{exitOutOfMemory, 510, "ran out of memory"}, true
+	case kestrel.CompletionTimedOut:
+		return outcome{exitTimedOut, 400, "exceeded the NEOS time limit"}, true
+	case kestrel.CompletionDisconnected:
+		return outcome{exitDisconnected, 520, "lost the connection to its solver host"}, true
+	case kestrel.CompletionSystemError:
+		return outcome{exitSystemError, 530, "failed because of a NEOS system error"}, true
+	}
+	return outcome{exitSystemError, 530, fmt.Sprintf("ended with completion code '%s'", code)}, true
+}
 
-func (k *Kestrel) getSolverName() (string, error) {
-	/*
-		Read in the kestrel_options to pick out the solver name.
-			The tricky parts:
-				we don't want to be case sensitive, but NEOS is.
-				we need to read in options variable
-	*/
-	// Get a list of available kestrel solvers from NEOS
-	request := struct {
-		Category string
-	}{"kestrel"}
-	result := struct {
-		Solvers []string
-	}{}
-	if err := k.Client.Call("listSolversInCategory", &request, &result); err != nil {
-		return "", err
-	}
-	allKestrelSolvers := result.Solvers
-	kestrelAmplSolvers := []string{}
-	for _, s := range allKestrelSolvers {
-		if strings.HasSuffix(s, ":AMPL") {
-			kestrelAmplSolvers = append(kestrelAmplSolvers, strings.TrimSuffix(s, ":AMPL"))
-		}
+// checkDimensions returns an error when sol does not fit the problem in the
+// .nl file of stub, as happens when retrieving a job into the wrong stub.
+func checkDimensions(stub string, jobNumber int, sol *amplfile.Solution) error {
+	header, err := amplfile.ReadNLFile(strings.TrimSuffix(stub, ".nl") + ".nl")
+	if err != nil {
+		fmt.Printf("Warning, cannot check the solution of job %d: %v\n", jobNumber, err)
+		return nil
 	}
-	chooseFrom := "Choose from:\n"
-	for _, s := range kestrelAmplSolvers {
-		chooseFrom += fmt.Sprintf("\t%s\n", s)
+	if sol.Constraints != header.Constraints || sol.Variables != header.Variables {
+		return fmt.Errorf("Error, the solution of job %d has %d constraints and %d variables "+
+			"but %s.nl has %d constraints and %d variables.\n"+
+			"Use kestrel retrieve --force to write it anyway.",
+			jobNumber, sol.Constraints, sol.Variables, strings.TrimSuffix(stub, ".nl"),
+			header.Constraints, header.Variables)
 	}
-	chooseFrom += "\nTo choose: option kestrel_options \"solver=xxx\";\n\n"
+	return nil
+}
 
-	// Read kestrel_options to get solver name
-	options := getOptions()
+// failureReason returns the outcome of a job that completed normally but
+// returned output rather than a solution.
+func failureReason(output string, err error) outcome {
+	lower := strings.ToLower(output)
+	switch {
+	case strings.Contains(lower, "killed") || strings.Contains(lower, "interrupted"):
+		return outcome{exitKilled, 600, "was killed before it finished"}
+	case strings.Contains(lower, "time limit") || strings.Contains(lower, "timed out"):
+		return outcome{exitTimedOut, 400, "exceeded its time limit"}
+	case errors.Is(err, amplfile.ErrEmptySolution):
+		return outcome{exitNoSolution, 500, "returned no solution"}
+	}
+	return outcome{exitNoSolution, 500, fmt.Sprintf("did not return a solution: %v", err)}
+}
 
-	solverName := ""
-	if match := solverRgx.FindStringSubmatch(options); len(match) == 2 {
-		solverName = match[1]
+// writeFailureSolution writes a .sol file for stub without any values, so
+// that AMPL sets solve_result_num and prints message instead of failing to
+// read a solution.
+func writeFailureSolution(stub string, solveResult int, message string) error {
+	stub = strings.TrimSuffix(stub, ".nl")
+	sol := amplfile.Solution{Message: message, Options: []int{1, 1, 0}, SolveResult: solveResult}
+	// AMPL rejects a .sol file whose dimensions differ from the problem
+	if header, err := amplfile.ReadNLFile(stub + ".nl"); err == nil {
+		sol.Constraints, sol.Variables = header.Constraints, header.Variables
 	}
-
-	if options == "" || solverName == "" {
-		return "", fmt.Errorf("No solver name selected. %s", chooseFrom)
+	content := new(strings.Builder)
+	if _, err := sol.WriteTo(content); err != nil {
+		return err
 	}
+	return writeSolution(content.String(), stub)
+}
 
-	neosSolverName := ""
-	for _, s := range kestrelAmplSolvers {
-		if strings.EqualFold(s, solverName) {
-			neosSolverName = s
-		}
+// writeSolution writes the .sol file for stub along with its validation file.
+func writeSolution(solution string, stub string) error {
+	solFile := strings.TrimSuffix(stub, ".nl") + ".sol"
+	size, err := writeToFile(solution, solFile)
+	if err != nil {
+		return err
 	}
-
-	if neosSolverName == "" {
-		return "", fmt.Errorf("%s is not available on NEOS. %s", solverName, chooseFrom)
+	if SolValidationEnv != "" {
+		return writeSolutionValidationFile(solFile, size)
 	}
-
-	return neosSolverName, nil
+	return nil
 }
 
-func (k *Kestrel) formXML(stub string) (string, error) {
-	/*
-		Create xml file for this problem
-	*/
-	stub = strings.TrimSuffix(stub, ".nl")
-	solver, err := k.getSolverName()
+func (k *Kestrel) kill(ctx context.Context, jobNumber int, password string) error {
+	response, err := k.KillJob(ctx, kestrel.Job{Number: jobNumber, Password: password})
 	if err != nil {
-		return "", err
+		return err
 	}
+	fmt.Println(response)
+	return nil
+}
 
-	// Get priority
-	priority := getPriority()
-	if priority != "" {
-		priority = fmt.Sprintf("<priority>%s</priority>\n", priority)
+func (k *Kestrel) getIntermediateResults(ctx context.Context, jobNumber int, password string, offset int) (string, int, error) {
+	output, err := k.IntermediateResultsNonBlocking(ctx, kestrel.Job{Number: jobNumber, Password: password}, offset)
+	if err != nil {
+		return "", 0, err
 	}
+	return output.Text, output.Offset, nil
+}
 
-	// Collect AMPL-created environment variables
-	solverOptions := fmt.Sprintf("kestrel_options:solver=%s\n", strings.ToLower(solver))
-	solverOptionsKey := fmt.Sprintf("%s_options", solver)
+func (k *Kestrel) getJobStatus(ctx context.Context, jobNumber int, password string) (kestrel.Status, error) {
+	return k.JobStatus(ctx, kestrel.Job{Number: jobNumber, Password: password})
+}
 
-	solverOptionsValue := getEnvOption(solverOptionsKey)
-	if solverOptionsValue != "" {
-		solverOptions += fmt.Sprintf("%s_options:%s\n", strings.ToLower(solver), solverOptionsValue)
+// getQueuePosition returns the position of a job among the jobs waiting on
+// NEOS, or 0 when it is not waiting or the queue is unavailable.
+func (k *Kestrel) getQueuePosition(ctx context.Context, jobNumber int) int {
+	queue, err := k.Queue(ctx)
+	if err != nil {
+		return 0
 	}
+	return kestrel.ParseQueue(queue).Position(jobNumber)
+}
 
-	source, err := os.Open(stub + ".nl")
+func (k *Kestrel) getSolverName(ctx context.Context) (string, error) {
+	/*
+		Read in the kestrel_options to pick out the solver name.
+			The tricky parts:
+				we don't want to be case sensitive, but NEOS is.
+				we need to read in options variable
+	*/
+	solverName := getKestrelOptions().Solver
+	solvers, cached, err := amplSolvers(ctx, k.Client, false)
 	if err != nil {
 		return "", err
 	}
-	defer source.Close()
-	buf := new(bytes.Buffer)
-	destination := gzip.NewWriter(buf)
-	if _, err := io.Copy(destination, source); err != nil {
-		return "", err
-	}
-	if err := destination.Close(); err != nil {
-		return "", err
+	solver, err := kestrel.MatchSolver(solvers, solverName)
+	var solverErr *kestrel.SolverError
+	if errors.As(err, &solverErr) && cached && solverName != "" {
+		// The solver may have been added since the catalog was cached
+		if solvers, _, err = amplSolvers(ctx, k.Client, true); err != nil {
+			return "", err
+		}
+		solver, err = kestrel.MatchSolver(solvers, solverName)
 	}
-
-	xml := fmt.Sprintf(`
-	<document>
-	<category>kestrel</category>
-	<solver>%s</solver>
-	<inputType>AMPL</inputType>
-	<email>%s</email>
-	%s
-	<solver_options>%s</solver_options>
-	<nlfile><base64>%s</base64></nlfile>\n`, solver, k.Email, priority,
-		solverOptions, base64.StdEncoding.EncodeToString(buf.Bytes()))
-
-	for _, key := range []string{"adj", "col", "env", "fix", "spc", "row", "slc", "unv"} {
-		if content, err := ioutil.ReadFile(stub + "." + key); err == nil && len(content) != 0 {
-			xml += fmt.Sprintf("<%s><![CDATA[%s]]></%s>\n", key, content, key)
+	if errors.As(err, &solverErr) {
+		chooseFrom := "Choose from:\n"
+		for _, s := range solverErr.Available {
+			chooseFrom += fmt.Sprintf("\t%s\n", s)
 		}
+		chooseFrom += "\nTo choose: option kestrel_options \"solver=xxx\";\n\n"
+		return "", fmt.Errorf("%v %s", err, chooseFrom)
 	}
+	return solver, err
+}
 
-	for _, option := range []string{"kestrel_auxfiles", "mip_priorities", "objective_precision"} {
+func (k *Kestrel) submission(ctx context.Context, stub string) (*kestrel.Submission, error) {
+	solver, err := k.getSolverName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header, err := amplfile.ReadNLFile(strings.TrimSuffix(stub, ".nl") + ".nl")
+	if err != nil {
+		return nil, fmt.Errorf("Error, %v", err)
+	}
+	fmt.Println(describeModel(header))
+	for _, warning := range kestrel.ModelWarnings(solver, header) {
+		fmt.Printf("Warning, %s.\n", warning)
+	}
+	// Collect AMPL-created environment variables
+	auxOptions := map[string]string{}
+	for _, option := range kestrel.AuxOptionNames {
 		if v, ok := os.LookupEnv(option); ok {
-			xml += fmt.Sprintf("<%s><![CDATA[%s]]></%s>\n", option, v, option)
+			auxOptions[option] = v
 		}
 	}
+	return &kestrel.Submission{
+		Stub:          stub,
+		Solver:        solver,
+		Email:         k.Email,
+		Priority:      getPriority(),
+		SolverOptions: getEnvOption(fmt.Sprintf("%s_options", solver)),
+		AuxOptions:    auxOptions,
+	}, nil
+}
 
-	xml += "</document>"
-	return xml, nil
+// describeModel summarizes the problem described by h in one line.
+func describeModel(h *amplfile.Header) string {
+	return fmt.Sprintf("%s problem: %d variables (%d integer), %d constraints (%d nonlinear), "+
+		"%d objectives (%d nonlinear), %s",
+		h.Class(), h.Variables, h.Discrete(), h.Constraints, h.NonlinearConstraints,
+		h.Objectives, h.NonlinearObjectives, formatSize(h.Size))
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d bytes", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
 func writeToFile(content string, fname string) (int, error) {
@@ -330,7 +429,3 @@ func writeToFile(content string, fname string) (int, error) {
 	}
 	return n, nil
 }
-
-func jobsFile() string {
-	return path.Join(os.TempDir(), fmt.Sprintf("at%s.jobs", getEnvOption("ampl_id")))
-}
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"ampl/gokestrel/amplfile"
+	"ampl/gokestrel/neos/kestrel"
+	"ampl/gokestrel/neos/neostest"
 )
 
 func TestMain(m *testing.M) {
 	// setup
 	_ = os.Remove(jobsFile())
+	cache, err := ioutil.TempDir("", "kestrelcache")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(cache)
+	cacheDir = func() (string, error) { return cache, nil }
+	configFile = func() string { return filepath.Join(cache, "config.toml") }
 	code := m.Run()
 	// shutdown
 	_ = os.Remove("kestresult.sol")
@@ -25,23 +40,24 @@ func TestSubmitKillRetrieve(t *testing.T) {
 	}
 	os.Setenv("email", email)
 	os.Setenv("kestrel_options", "solver=cplex")
-	k, err := NewKestrel()
+	ctx := context.Background()
+	k, err := NewKestrel(ctx)
 	if err != nil {
 		t.Fatalf("NewKestrel failed with '%v'", err)
 	}
-	xml, err := k.formXML(stub)
+	submission, err := k.submission(ctx, stub)
 	if err != nil {
-		t.Fatalf("k.formXML failed with '%v'", err)
+		t.Fatalf("k.submission failed with '%v'", err)
 	}
-	jobNumber, password, err := k.submit(xml)
+	jobNumber, password, err := k.submit(ctx, submission)
 	if err != nil {
 		t.Fatalf("k.submit failed with '%v'", err)
 	}
-	err = k.kill(jobNumber, password)
+	err = k.kill(ctx, jobNumber, password)
 	if err != nil {
 		t.Fatalf("k.kill failed with '%v'", err)
 	}
-	err = k.retrieve(stub, jobNumber, password)
+	_, err = k.retrieve(ctx, stub, jobNumber, password, false)
 	if err != nil {
 		t.Fatalf("k.retrieve failed with '%v'", err)
 	}
@@ -55,21 +71,19 @@ func TestSolve(t *testing.T) {
 	}
 	os.Setenv("email", email)
 	os.Setenv("kestrel_options", "solver=cplex")
-	sigint := make(chan os.Signal, 1)
-	exit, err := solve(stub, sigint)
+	exit, err := solve(context.Background(), stub)
 	if want := 0; exit != want {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
-	sigint <- os.Interrupt
-	exit, err = solve(stub, sigint)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exit, err = solve(ctx, stub)
 	if want := 1; exit != want || err != nil {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
-	go func() {
-		time.Sleep(5 * time.Second)
-		sigint <- os.Interrupt
-	}()
-	exit, err = solve(stub, sigint)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	exit, err = solve(ctx, stub)
 	if want := 1; exit != want || err != nil {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
@@ -88,13 +102,12 @@ func TestAuthenticated(t *testing.T) {
 	os.Setenv("kestrel_options", "solver=cplex")
 	os.Setenv("neos_username", username)
 	os.Setenv("neos_user_password", password)
-	sigint := make(chan os.Signal, 1)
-	exit, err := solve(stub, sigint)
+	exit, err := solve(context.Background(), stub)
 	if want := 0; exit != want {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
 	os.Setenv("neos_user_password", "wrong_password")
-	exit, err = solve(stub, sigint)
+	exit, err = solve(context.Background(), stub)
 	if want := 1; exit != want || err == nil {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
@@ -110,13 +123,12 @@ func TestPriority(t *testing.T) {
 	os.Setenv("email", email)
 	os.Setenv("kestrel_options", "solver=cplex priority=short")
 	os.Setenv("cplex_options", "lpdisplay=1")
-	sigint := make(chan os.Signal, 1)
-	exit, err := solve(stub, sigint)
+	exit, err := solve(context.Background(), stub)
 	if want := 0; exit != want || err != nil {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
 	os.Setenv("kestrel_options", "solver=cplex priority=long")
-	exit, err = solve(stub, sigint)
+	exit, err = solve(context.Background(), stub)
 	if want := 0; exit != want || err != nil {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
@@ -130,11 +142,11 @@ func TestSubmitRetrieve(t *testing.T) {
 	}
 	os.Setenv("email", email)
 	os.Setenv("kestrel_options", "solver=cplex")
-	exit, err := submit(stub)
+	exit, err := submit(context.Background(), stub, "")
 	if want := 0; exit != want {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
-	exit, err = retrieve(stub)
+	exit, err = retrieve(context.Background(), stub, 0, "", false)
 	if want := 0; exit != want {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
@@ -184,11 +196,11 @@ func TestRunSubmitKill(t *testing.T) {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
 	for _, job := range jobs {
-		exit, err = run([]string{"kestrel", "kill", strconv.Itoa(job.jobNumber), job.password})
+		exit, err = run([]string{"kestrel", "kill", strconv.Itoa(job.Number), job.Password})
 		if want := 0; exit != want || err != nil {
 			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 		}
-		os.Setenv("kestrel_options", fmt.Sprintf("job=%d password=%s", job.jobNumber, job.password))
+		os.Setenv("kestrel_options", fmt.Sprintf("job=%d password=%s", job.Number, job.Password))
 		exit, err = run([]string{"kestrel", "kill"})
 		if want := 0; exit != want || err != nil {
 			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
@@ -241,3 +253,989 @@ func TestRunSubmitRetrieve(t *testing.T) {
 		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
 	}
 }
+
+// startNEOS starts a fake NEOS server, points kestrel at it and returns it
+// together with a stub whose .nl lives in a temporary directory.
+func startNEOS(t *testing.T) (*neostest.Server, string) {
+	t.Helper()
+	srv := neostest.NewServer()
+	httpClient = srv.Client()
+	interval, retry, cache := pollInterval, retryPolicy, cacheDir
+	pollInterval = 10 * time.Millisecond
+	retryPolicy = kestrel.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond}
+	dir := t.TempDir()
+	cacheDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() {
+		srv.Close()
+		httpClient = nil
+		pollInterval, retryPolicy, cacheDir = interval, retry, cache
+		unsetEnv("neos_server", "email", "kestrel_options")
+		_ = os.Remove(jobsFile())
+	})
+	os.Setenv("neos_server", srv.Address())
+	os.Setenv("email", "test@test.com")
+	os.Setenv("kestrel_options", "solver=cplex")
+	stub := filepath.Join(t.TempDir(), "tiny")
+	nl, err := ioutil.ReadFile(filepath.Join("testdata", "tiny.nl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(stub+".nl", nl, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return srv, stub
+}
+
+func readSolution(t *testing.T, stub string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(stub + ".sol")
+	if err != nil {
+		t.Fatalf("reading %s.sol failed with '%v'", stub, err)
+	}
+	return string(content)
+}
+
+func TestFakeSubmitKillRetrieve(t *testing.T) {
+	srv, stub := startNEOS(t)
+	ctx := context.Background()
+	k, err := NewKestrel(ctx)
+	if err != nil {
+		t.Fatalf("NewKestrel failed with '%v'", err)
+	}
+	submission, err := k.submission(ctx, stub)
+	if err != nil {
+		t.Fatalf("k.submission failed with '%v'", err)
+	}
+	jobNumber, password, err := k.submit(ctx, submission)
+	if err != nil {
+		t.Fatalf("k.submit failed with '%v'", err)
+	}
+	job := srv.Job(jobNumber)
+	if job == nil || job.Password != password {
+		t.Fatalf("job %d/%s not found on server", jobNumber, password)
+	}
+	if !strings.Contains(job.Document, "<solver>CPLEX</solver>") {
+		t.Errorf("unexpected document '%s'", job.Document)
+	}
+	if err := k.kill(ctx, jobNumber, password); err != nil {
+		t.Fatalf("k.kill failed with '%v'", err)
+	}
+	if !job.Killed {
+		t.Errorf("job %d was not killed", jobNumber)
+	}
+	if exit, err := k.retrieve(ctx, stub, jobNumber, password, false); exit != exitKilled || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, exitKilled)
+	}
+	sol := readFailureSolution(t, stub)
+	if sol.SolveResult != 600 || !strings.Contains(sol.Message, fmt.Sprintf("job %d was killed", jobNumber)) {
+		t.Errorf("got '%v', '%v', want 600", sol.SolveResult, sol.Message)
+	}
+}
+
+// readFailureSolution reads a .sol file written by writeFailureSolution for
+// the problem in testdata/tiny.nl.
+func readFailureSolution(t *testing.T, stub string) *amplfile.Solution {
+	t.Helper()
+	sol, err := amplfile.ParseSolution([]byte(readSolution(t, stub)))
+	if err != nil {
+		t.Fatalf("ParseSolution failed with '%v'", err)
+	}
+	if sol.Constraints != 1 || sol.Variables != 2 || sol.Primals != 0 || sol.Duals != 0 {
+		t.Errorf("got '%+v', want 1 constraint and 2 variables without values", sol)
+	}
+	return sol
+}
+
+func TestFakeSolve(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps: []neostest.Step{
+			{Status: "Waiting"},
+			{Status: "Running", Output: "iteration 1\n"},
+			{Status: "Running", Output: "iteration 2\n"},
+			{Status: "Done", Output: "optimal solution; objective 30\n"},
+		},
+		Solution: neostest.SolFile("optimal solution; objective 30", []float64{1}, []float64{10, 20}, 0),
+	}
+	exit, err := solve(context.Background(), stub)
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if got, want := readSolution(t, stub), srv.Lifecycle.Solution; got != want {
+		t.Errorf("got '%v', want '%v'", got, want)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	exit, err = solve(ctx, stub)
+	if want := 1; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+}
+
+func TestFakeSolveInterrupted(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps: []neostest.Step{{Status: "Running"}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	exit, err := solve(ctx, stub)
+	if want := 1; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if srv.Jobs() != 1 {
+		t.Errorf("got %d jobs, want 1", srv.Jobs())
+	}
+}
+
+func TestFakeSolveDroppedConnections(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps:    []neostest.Step{{Status: "Running"}, {Status: "Running"}, {Status: "Running"}, {Status: "Done"}},
+		Solution: neostest.DefaultLifecycle.Solution,
+	}
+	exit, err := submit(context.Background(), stub, "")
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	jobs, _ := listJobs(jobsFile())
+	os.Setenv("kestrel_options", fmt.Sprintf("job=%d password=%s", jobs[0].Number, jobs[0].Password))
+	srv.DropConnections(2, 2) // after ping and the first poll
+	exit, err = solve(context.Background(), stub)
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	readSolution(t, stub)
+}
+
+func TestFakeSolveConnectionLost(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps: []neostest.Step{{Status: "Running"}},
+	}
+	exit, err := submit(context.Background(), stub, "")
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	jobs, _ := listJobs(jobsFile())
+	os.Setenv("kestrel_options", fmt.Sprintf("job=%d password=%s", jobs[0].Number, jobs[0].Password))
+	srv.DropConnections(1, 1000) // after ping
+	exit, err = solve(context.Background(), stub)
+	if want := 1; exit != want || err == nil || !strings.Contains(err.Error(), "lost connection") {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if _, err := os.Stat(stub + ".sol"); err == nil {
+		t.Errorf("%s.sol written for an unfinished job", stub)
+	}
+}
+
+func TestFakeSolveUnknownJob(t *testing.T) {
+	_, stub := startNEOS(t)
+	os.Setenv("kestrel_options", "job=1 password=x")
+	exit, err := solve(context.Background(), stub)
+	if want := 1; exit != want || err == nil || !strings.Contains(err.Error(), "Unknown Job") {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if _, err := os.Stat(stub + ".sol"); err == nil {
+		t.Errorf("%s.sol written for an unknown job", stub)
+	}
+}
+
+func TestFakeSolveJobAndPassword(t *testing.T) {
+	srv, stub := startNEOS(t)
+	exit, err := submit(context.Background(), stub, "")
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	jobs, err := listJobs(jobsFile())
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("listJobs returned '%v', '%v'", jobs, err)
+	}
+	os.Setenv("kestrel_options", fmt.Sprintf("job=%d password=%s", jobs[0].Number, jobs[0].Password))
+	exit, err = solve(context.Background(), stub)
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if got, want := srv.Jobs(), 1; got != want {
+		t.Errorf("got %d jobs, want %d", got, want)
+	}
+}
+
+func TestFakeAuthenticated(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Users["user"] = "secret"
+	defer unsetEnv("neos_username", "neos_user_password")
+	os.Setenv("neos_username", "user")
+	os.Setenv("neos_user_password", "secret")
+	exit, err := solve(context.Background(), stub)
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	os.Setenv("neos_user_password", "wrong_password")
+	exit, err = solve(context.Background(), stub)
+	if want := 1; exit != want || err == nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+}
+
+func TestFakeRunSubmitRetrieve(t *testing.T) {
+	_, stub := startNEOS(t)
+	exit, err := run([]string{"kestrel", "retrieve", stub}) // should fail
+	if want := 1; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	for i := 0; i < 2; i++ {
+		exit, err = run([]string{"kestrel", "submit", stub})
+		if want := 0; exit != want || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		exit, err = run([]string{"kestrel", "retrieve", stub})
+		if want := 0; exit != want || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+		}
+	}
+	readSolution(t, stub)
+	exit, err = run([]string{"kestrel", "retrieve", stub}) // should fail
+	if want := 1; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+}
+
+func TestFakeRunKill(t *testing.T) {
+	srv, stub := startNEOS(t)
+	exit, err := run([]string{"kestrel", "submit", stub})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	jobs, err := listJobs(jobsFile())
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("listJobs returned '%v', '%v'", jobs, err)
+	}
+	exit, err = run([]string{"kestrel", "kill", strconv.Itoa(jobs[0].Number), jobs[0].Password})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if !srv.Job(jobs[0].Number).Killed {
+		t.Errorf("job %d was not killed", jobs[0].Number)
+	}
+}
+
+func TestFakeGetSolverName(t *testing.T) {
+	startNEOS(t)
+	os.Setenv("kestrel_options", " solver = IpOpT")
+	ctx := context.Background()
+	k, err := NewKestrel(ctx)
+	if err != nil {
+		t.Fatalf("NewKestrel failed with '%v'", err)
+	}
+	solver, err := k.getSolverName(ctx)
+	if want := "Ipopt"; solver != want || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", solver, err, want)
+	}
+	os.Setenv("kestrel_options", "solver=gams")
+	if _, err := k.getSolverName(ctx); err == nil {
+		t.Errorf("expected an error for an unavailable solver")
+	}
+}
+
+func TestFakeRunStatus(t *testing.T) {
+	_, stub := startNEOS(t)
+	exit, err := run([]string{"kestrel", "status"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	for i := 0; i < 2; i++ {
+		exit, err = run([]string{"kestrel", "submit", stub})
+		if want := 0; exit != want || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+		}
+	}
+	exit, err = run([]string{"kestrel", "status"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	jobs, err := listJobs(jobsFile())
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("listJobs returned '%v', '%v'", jobs, err)
+	}
+	for _, job := range jobs {
+		if job.Status != "Running" || job.Solver != "CPLEX" {
+			t.Errorf("got '%v', want a running CPLEX job", job)
+		}
+	}
+	exit, err = run([]string{"kestrel", "status", strconv.Itoa(jobs[0].Number), jobs[0].Password})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if jobs, _ := listJobs(jobsFile()); len(jobs) != 2 || jobs[0].Status != "Running" {
+		t.Errorf("got '%v', explicit status should not update the queue", jobs)
+	}
+}
+
+func TestFakeRunWait(t *testing.T) {
+	srv, stub := startNEOS(t)
+	exit, err := run([]string{"kestrel", "wait"}) // should fail
+	if want := 1; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	stubs := []string{stub, stub + "2"}
+	nl, _ := ioutil.ReadFile(stub + ".nl")
+	if err := ioutil.WriteFile(stubs[1]+".nl", nl, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		exit, err = run([]string{"kestrel", "submit", stubs[i%2]})
+		if want := 0; exit != want || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+		}
+	}
+	exit, err = run([]string{"kestrel", "wait"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if jobs, _ := listJobs(jobsFile()); len(jobs) != 2 {
+		t.Errorf("got %d queued jobs, want 2", len(jobs))
+	}
+	exit, err = run([]string{"kestrel", "wait", "--all"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if jobs, _ := listJobs(jobsFile()); len(jobs) != 0 {
+		t.Errorf("got %d queued jobs, want 0", len(jobs))
+	}
+	for _, stub := range stubs {
+		readSolution(t, stub)
+	}
+	for i := 1001; i <= 1003; i++ {
+		if srv.Job(i).Status() != "Done" {
+			t.Errorf("job %d is not done", i)
+		}
+	}
+}
+
+func TestFakeRunWaitJob(t *testing.T) {
+	_, stub := startNEOS(t)
+	exit, err := run([]string{"kestrel", "submit", stub})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	jobs, _ := listJobs(jobsFile())
+	exit, err = run([]string{"kestrel", "wait", strconv.Itoa(jobs[0].Number), jobs[0].Password})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	// Written next to the model it was submitted from, not to kmodel
+	readSolution(t, stub)
+	if jobs, _ := listJobs(jobsFile()); len(jobs) != 0 {
+		t.Errorf("got %d queued jobs, want 0", len(jobs))
+	}
+}
+
+func TestFakeRunRetrieveJob(t *testing.T) {
+	_, stub := startNEOS(t)
+	stub2 := filepath.Join(t.TempDir(), "other")
+	nl, _ := ioutil.ReadFile(stub + ".nl")
+	if err := ioutil.WriteFile(stub2+".nl", nl, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{stub}, {stub2, "--name", "second"}, {stub, "--name=third"}} {
+		exit, err := run(append([]string{"kestrel", "submit"}, args...))
+		if want := 0; exit != want || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+		}
+	}
+	jobs, _ := listJobs(jobsFile())
+	if len(jobs) != 3 || jobs[1].Name != "second" || jobs[1].Stub != stub2 {
+		t.Fatalf("got '%v'", jobs)
+	}
+	exit, err := run([]string{"kestrel", "retrieve", "--name", "second"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	readSolution(t, stub2)
+	exit, err = run([]string{"kestrel", "retrieve", "--job", strconv.Itoa(jobs[2].Number)})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	readSolution(t, stub)
+	exit, err = run([]string{"kestrel", "retrieve", "--job", strconv.Itoa(jobs[2].Number)}) // should fail
+	if want := 1; exit != want || err == nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	exit, err = run([]string{"kestrel", "retrieve", "--name", "second"}) // should fail
+	if want := 1; exit != want || err == nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if left, _ := listJobs(jobsFile()); len(left) != 1 || left[0].Number != jobs[0].Number {
+		t.Errorf("got '%v', want the first job left", left)
+	}
+}
+
+func TestFakeRunRetrieveStub(t *testing.T) {
+	_, stub := startNEOS(t)
+	dir := t.TempDir()
+	stub2 := filepath.Join(dir, "other")
+	nl, _ := ioutil.ReadFile(stub + ".nl")
+	if err := ioutil.WriteFile(stub2+".nl", nl, 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{stub, "other.nl", stub} {
+		exit, err := run([]string{"kestrel", "submit", s})
+		if want := 0; exit != want || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+		}
+	}
+	if jobs, _ := listJobs(jobsFile()); jobs[1].Stub != stub2 {
+		t.Errorf("got '%v', want '%v'", jobs[1].Stub, stub2)
+	}
+	exit, err := run([]string{"kestrel", "retrieve"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	readSolution(t, stub)
+	exit, err = run([]string{"kestrel", "retrieve"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	readSolution(t, stub2)
+	// An explicit stub takes precedence over the recorded one
+	exit, err = run([]string{"kestrel", "retrieve", "third"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	readSolution(t, filepath.Join(dir, "third"))
+}
+
+func TestFakeSubmissionNotNL(t *testing.T) {
+	srv, stub := startNEOS(t)
+	ctx := context.Background()
+	if err := ioutil.WriteFile(stub+".nl", []byte("<html>Error</html>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	k, err := NewKestrel(ctx)
+	if err != nil {
+		t.Fatalf("NewKestrel failed with '%v'", err)
+	}
+	if _, err := k.submission(ctx, stub); err == nil || !strings.Contains(err.Error(), "not an .nl file") {
+		t.Errorf("got '%v', want 'not an .nl file'", err)
+	}
+	if srv.Jobs() != 0 {
+		t.Errorf("got %d jobs, want 0", srv.Jobs())
+	}
+}
+
+func TestDescribeModel(t *testing.T) {
+	var tests = []struct {
+		header amplfile.Header
+		want   string
+	}{
+		{
+			amplfile.Header{Variables: 2, Constraints: 1, Objectives: 1, Size: 120},
+			"LP problem: 2 variables (0 integer), 1 constraints (0 nonlinear), 1 objectives (0 nonlinear), 120 bytes",
+		},
+		{
+			amplfile.Header{Variables: 10, Constraints: 6, Objectives: 1, NonlinearConstraints: 4,
+				BinaryVariables: 3, Size: 5 << 29},
+			"MINLP problem: 10 variables (3 integer), 6 constraints (4 nonlinear), 1 objectives (0 nonlinear), 2.5 GB",
+		},
+	}
+	for _, tt := range tests {
+		if got := describeModel(&tt.header); got != tt.want {
+			t.Errorf("got '%v', want '%v'", got, tt.want)
+		}
+	}
+}
+
+func TestFakeRetrieveFailure(t *testing.T) {
+	var tests = []struct {
+		solution    string
+		code        string
+		exit        int
+		solveResult int
+		message     string
+	}{
+		{"", "", exitNoSolution, 500, "returned no solution"},
+		{"<html><body>Internal Server Error</body></html>\n", "", exitNoSolution, 500, "did not return a solution: not a .sol file"},
+		{"Solver exceeded the time limit of 28800 seconds\n", "", exitTimedOut, 400, "exceeded its time limit"},
+		{"", "Out of memory", exitOutOfMemory, 510, "ran out of memory"},
+		{"", "Timed out", exitTimedOut, 400, "exceeded the NEOS time limit"},
+		{"", "Disconnected", exitDisconnected, 520, "lost the connection to its solver host"},
+		// A solution is not used when the job did not complete normally
+		{neostest.DefaultLifecycle.Solution, "System error", exitSystemError, 530, "failed because of a NEOS system error"},
+		{"", "Aborted", exitSystemError, 530, "ended with completion code 'Aborted'"},
+	}
+	for _, tt := range tests {
+		srv, stub := startNEOS(t)
+		srv.Lifecycle = neostest.Lifecycle{Steps: []neostest.Step{{Status: "Done"}}, Solution: tt.solution, CompletionCode: tt.code}
+		ctx := context.Background()
+		k, err := NewKestrel(ctx)
+		if err != nil {
+			t.Fatalf("NewKestrel failed with '%v'", err)
+		}
+		submission, err := k.submission(ctx, stub)
+		if err != nil {
+			t.Fatalf("k.submission failed with '%v'", err)
+		}
+		jobNumber, password, err := k.submit(ctx, submission)
+		if err != nil {
+			t.Fatalf("k.submit failed with '%v'", err)
+		}
+		if exit, err := k.retrieve(ctx, stub, jobNumber, password, false); exit != tt.exit || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, tt.exit)
+		}
+		sol := readFailureSolution(t, stub)
+		want := fmt.Sprintf("kestrel: NEOS job %d %s", jobNumber, tt.message)
+		if sol.SolveResult != tt.solveResult || !strings.HasPrefix(sol.Message, want) {
+			t.Errorf("got '%v', '%v', want '%v', '%v'", sol.SolveResult, sol.Message, tt.solveResult, want)
+		}
+	}
+}
+
+func TestFakeRunRetrieveMismatch(t *testing.T) {
+	_, stub := startNEOS(t)
+	exit, err := run([]string{"kestrel", "submit", stub})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	// Another model with 3 variables and 2 constraints
+	other := filepath.Join(t.TempDir(), "other")
+	nl := strings.Replace(string(readNL(t, stub)), " 2 1 1 0 0", " 3 2 1 0 0", 1)
+	if err := ioutil.WriteFile(other+".nl", []byte(nl), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exit, err = run([]string{"kestrel", "retrieve", other}) // should fail
+	if want := 1; exit != want || err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if _, err := os.Stat(other + ".sol"); !os.IsNotExist(err) {
+		t.Errorf("got '%v', want no .sol file", err)
+	}
+	if jobs, _ := listJobs(jobsFile()); len(jobs) != 1 {
+		t.Fatalf("got %d jobs, want the job to stay queued", len(jobs))
+	}
+	exit, err = run([]string{"kestrel", "retrieve", other, "--force"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	readSolution(t, other)
+}
+
+func readNL(t *testing.T, stub string) []byte {
+	t.Helper()
+	content, err := ioutil.ReadFile(stub + ".nl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestFakeRunSolvers(t *testing.T) {
+	srv, _ := startNEOS(t)
+	exit, err := run([]string{"kestrel", "solvers"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	catalog, err := readSolverCatalog(srv.Address())
+	if err != nil || catalog == nil || strings.Join(catalog.Solvers, ",") != "CPLEX,Gurobi,Ipopt" {
+		t.Fatalf("got '%+v', '%v'", catalog, err)
+	}
+	// The cache is used until it expires or is refreshed
+	srv.Solvers = []string{"CPLEX:AMPL", "HiGHS:AMPL"}
+	ctx := context.Background()
+	client, err := connect(ctx)
+	if err != nil {
+		t.Fatalf("connect failed with '%v'", err)
+	}
+	solvers, cached, err := amplSolvers(ctx, client, false)
+	if got := strings.Join(solvers, ","); got != "CPLEX,Gurobi,Ipopt" || !cached || err != nil {
+		t.Errorf("got '%v', '%v', '%v'", got, cached, err)
+	}
+	exit, err = run([]string{"kestrel", "solvers", "--refresh"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	if catalog, _ := readSolverCatalog(srv.Address()); strings.Join(catalog.Solvers, ",") != "CPLEX,HiGHS" {
+		t.Errorf("got '%+v', want the refreshed list", catalog)
+	}
+	ttl := solverCacheTTL
+	defer func() { solverCacheTTL = ttl }()
+	solverCacheTTL = 0
+	srv.Solvers = []string{"CPLEX:AMPL"}
+	if solvers, cached, err := amplSolvers(ctx, client, false); len(solvers) != 1 || cached || err != nil {
+		t.Errorf("got '%v', '%v', '%v', want an expired cache to be reloaded", solvers, cached, err)
+	}
+	// An unreachable server falls back to the outdated cache
+	srv.Close()
+	exit, err = run([]string{"kestrel", "solvers"})
+	if want := 0; exit != want || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	cache := cacheDir
+	defer func() { cacheDir = cache }()
+	cacheDir = func() (string, error) { return t.TempDir(), nil }
+	exit, err = run([]string{"kestrel", "solvers"}) // should fail without a cache
+	if want := 1; exit != want || err == nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+}
+
+func TestFakeGetSolverNameCached(t *testing.T) {
+	srv, _ := startNEOS(t)
+	// Only the cache knows about Fake, so resolving it needs no NEOS call
+	catalog := &solverCatalog{Server: srv.Address(), Updated: time.Now(), Solvers: []string{"CPLEX", "Fake"}}
+	if err := writeSolverCatalog(catalog); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	k, err := NewKestrel(ctx)
+	if err != nil {
+		t.Fatalf("NewKestrel failed with '%v'", err)
+	}
+	os.Setenv("kestrel_options", "solver=fake")
+	if solver, err := k.getSolverName(ctx); solver != "Fake" || err != nil {
+		t.Errorf("got '%v', '%v', want 'Fake'", solver, err)
+	}
+	// A solver missing from the cache is looked up on NEOS
+	os.Setenv("kestrel_options", "solver=ipopt")
+	if solver, err := k.getSolverName(ctx); solver != "Ipopt" || err != nil {
+		t.Errorf("got '%v', '%v', want 'Ipopt'", solver, err)
+	}
+	if catalog, _ := readSolverCatalog(srv.Address()); len(catalog.Solvers) != 3 {
+		t.Errorf("got '%+v', want the refreshed list", catalog)
+	}
+}
+
+// captureOutput returns what f prints to stdout.
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- string(b)
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestFakeRunRedact(t *testing.T) {
+	_, stub := startNEOS(t)
+	os.Setenv("kestrel_options", "solver=cplex redact=1")
+	output := captureOutput(t, func() {
+		for i := 0; i < 2; i++ {
+			if exit, err := run([]string{"kestrel", "submit", stub}); exit != 0 || err != nil {
+				t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+			}
+		}
+		if exit, err := run([]string{"kestrel", "retrieve", stub}); exit != 0 || err != nil {
+			t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+		}
+		// The password of the remaining job is found in the queue
+		os.Setenv("kestrel_options", "solver=cplex redact=1 job=1002")
+		if exit, err := run([]string{"kestrel", "kill"}); exit != 0 || err != nil {
+			t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+		}
+		os.Setenv("kestrel_options", "solver=cplex redact=1")
+		if exit, err := solve(context.Background(), stub); exit != 0 || err != nil {
+			t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+		}
+	})
+	if strings.Contains(output, "pw100") || !strings.Contains(output, "password='********'") ||
+		!strings.Contains(output, "pass=********") || !strings.Contains(output, "1002 ********") {
+		t.Errorf("got '%v', want redacted passwords", output)
+	}
+	// Only the job killed remains queued, solve removed its own job
+	jobs, err := listJobs(jobsFile())
+	if err != nil || len(jobs) != 1 || jobs[0].Number != 1002 {
+		t.Errorf("got '%v', '%v', want job 1002 queued", jobs, err)
+	}
+}
+
+func TestFakeRunWaitOutcome(t *testing.T) {
+	_, stub := startNEOS(t)
+	for i := 0; i < 2; i++ {
+		if exit, err := run([]string{"kestrel", "submit", stub}); exit != 0 || err != nil {
+			t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+		}
+	}
+	if exit, err := run([]string{"kestrel", "kill", "1001", "pw1001"}); exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	exit, err := run([]string{"kestrel", "wait", "--all"})
+	if exit != exitKilled || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, exitKilled)
+	}
+	// Jobs that ended without a solution are retrieved all the same
+	if jobs, err := listJobs(jobsFile()); len(jobs) != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want no jobs queued", jobs, err)
+	}
+	readSolution(t, stub)
+}
+
+func TestFakeSolveOutcome(t *testing.T) {
+	srv, stub := startNEOS(t)
+	lifecycle := neostest.DefaultLifecycle
+	lifecycle.CompletionCode = "Timed out"
+	srv.Lifecycle = lifecycle
+	// AMPL reads the .sol file only when solve exits normally
+	exit, err := solve(context.Background(), stub)
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	if sol := readSolution(t, stub); !strings.Contains(sol, "exceeded the NEOS time limit") {
+		t.Errorf("got '%v', want the outcome in the .sol file", sol)
+	}
+}
+
+func TestFakeRunFetch(t *testing.T) {
+	srv, stub := startNEOS(t)
+	lifecycle := neostest.DefaultLifecycle
+	lifecycle.Files = map[string]string{"cplex.log": "CPLEX log\n", "iis.ilp": "IIS\n"}
+	srv.Lifecycle = lifecycle
+	if exit, err := run([]string{"kestrel", "submit", stub}); exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	// Waits for the job to finish, then writes the files next to its stub
+	exit, err := run([]string{"kestrel", "fetch", "1001", "pw1001", "cplex.log", "iis.ilp"})
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	for name, want := range lifecycle.Files {
+		content, err := ioutil.ReadFile(filepath.Join(filepath.Dir(stub), name))
+		if string(content) != want || err != nil {
+			t.Errorf("got '%s', '%v', want '%v'", content, err, want)
+		}
+	}
+	exit, err = run([]string{"kestrel", "fetch", "1001", "pw1001", "missing.log"})
+	if exit != 1 || err == nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 1)
+	}
+	exit, err = run([]string{"kestrel", "fetch", "1001", "pw1001", "../cplex.log"})
+	if exit != 1 || err == nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 1)
+	}
+	exit, err = run([]string{"kestrel", "fetch", "1001", "wrong", "cplex.log"})
+	if exit != 1 || err == nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 1)
+	}
+}
+
+func TestFakeSolveOutputs(t *testing.T) {
+	srv, stub := startNEOS(t)
+	lifecycle := neostest.DefaultLifecycle
+	lifecycle.Files = map[string]string{"cplex.log": "CPLEX log\n"}
+	srv.Lifecycle = lifecycle
+	os.Setenv("kestrel_options", "solver=cplex outputs=cplex.log,missing.log")
+	// A missing output file does not fail the solve
+	exit, err := solve(context.Background(), stub)
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	readSolution(t, stub)
+	content, err := ioutil.ReadFile(filepath.Join(filepath.Dir(stub), "cplex.log"))
+	if string(content) != "CPLEX log\n" || err != nil {
+		t.Errorf("got '%s', '%v', want '%v'", content, err, "CPLEX log\n")
+	}
+}
+
+func TestPoller(t *testing.T) {
+	start, interval := pollStart, pollInterval
+	defer func() { pollStart, pollInterval = start, interval }()
+	pollStart, pollInterval = time.Second, 4*time.Second
+	p := newPoller()
+	var delays []time.Duration
+	for _, progress := range []bool{false, false, false, false, true, false} {
+		delays = append(delays, p.next(progress))
+	}
+	want := []time.Duration{1500 * time.Millisecond, 2250 * time.Millisecond, 3375 * time.Millisecond,
+		4 * time.Second, time.Second, 1500 * time.Millisecond}
+	if p.max != 4*time.Second || fmt.Sprint(delays) != fmt.Sprint(want) {
+		t.Errorf("got '%v', '%v', want '%v'", p.max, delays, want)
+	}
+	defer unsetEnv("kestrel_options")
+	pollStart = 2 * time.Second
+	os.Setenv("kestrel_options", "poll=1.5")
+	if p := newPoller(); p.delay != 1500*time.Millisecond || p.max != 1500*time.Millisecond {
+		t.Errorf("got '%v', '%v', want '%v'", p.delay, p.max, 1500*time.Millisecond)
+	}
+}
+
+func TestFakeSolveNonBlocking(t *testing.T) {
+	srv, stub := startNEOS(t)
+	var exit int
+	var err error
+	output := captureOutput(t, func() {
+		exit, err = solve(context.Background(), stub)
+	})
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	for _, step := range neostest.DefaultLifecycle.Steps {
+		if !strings.Contains(output, step.Output) {
+			t.Errorf("got '%v', want '%v' in the output", output, step.Output)
+		}
+	}
+	if n := srv.Calls("getIntermediateResults"); n != 0 {
+		t.Errorf("got %d blocking calls, want none", n)
+	}
+	if n := srv.Calls("getIntermediateResultsNonBlocking"); n == 0 {
+		t.Errorf("got no non-blocking calls")
+	}
+}
+
+func TestFakeSolveLong(t *testing.T) {
+	srv, stub := startNEOS(t)
+	os.Setenv("kestrel_options", "solver=cplex priority=long")
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps: []neostest.Step{
+			{Status: "Waiting"}, {Status: "Waiting"}, {Status: "Waiting"},
+			{Status: "Running", Output: "Job submitted to NEOS HTCondor pool.\n"},
+			{Status: "Done", Output: "optimal solution\n"},
+		},
+		Solution: neostest.DefaultLifecycle.Solution,
+	}
+	heartbeat := heartbeatInterval
+	heartbeatInterval = 5 * time.Millisecond
+	t.Cleanup(func() { heartbeatInterval = heartbeat })
+	var exit int
+	var err error
+	output := captureOutput(t, func() {
+		exit, err = solve(context.Background(), stub)
+	})
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	for _, want := range []string{"long priority", "Job 1001: Waiting, position 1 in the NEOS queue", "Job 1001 done"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("got '%v', want '%v' in the output", output, want)
+		}
+	}
+	if n := srv.Calls("getIntermediateResultsNonBlocking") + srv.Calls("getIntermediateResults"); n != 0 {
+		t.Errorf("got %d output calls, want none", n)
+	}
+	if _, err := os.Stat(stub + ".sol"); err != nil {
+		t.Errorf("got '%v', want a solution", err)
+	}
+}
+
+func TestFakeSolveLongDetach(t *testing.T) {
+	_, stub := startNEOS(t)
+	os.Setenv("kestrel_options", "solver=cplex priority=long detach=1")
+	exit, err := solve(context.Background(), stub)
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	if sol := readFailureSolution(t, stub); sol.SolveResult != 540 || !strings.Contains(sol.Message, "job 1001 detached") {
+		t.Errorf("got '%v', '%v', want 540", sol.SolveResult, sol.Message)
+	}
+	// kestrelret picks the job up from the queue
+	os.Setenv("kestrel_options", "solver=cplex")
+	exit, err = retrieve(context.Background(), "", 0, "", false)
+	if exit != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	if jobs, err := listJobs(jobsFile()); len(jobs) != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want an empty queue", jobs, err)
+	}
+}
+
+func TestFakeSolveLongInterrupt(t *testing.T) {
+	srv, stub := startNEOS(t)
+	os.Setenv("kestrel_options", "solver=cplex priority=long redact=1")
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps:    []neostest.Step{{Status: "Waiting"}, {Status: "Waiting"}, {Status: "Waiting"}, {Status: "Done"}},
+		Solution: neostest.DefaultLifecycle.Solution,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var exit int
+	var err error
+	output := captureOutput(t, func() {
+		go func() {
+			// Interrupt once solve waits for the job
+			for srv.Calls("getJobStatus") == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+		}()
+		exit, err = solve(ctx, stub)
+	})
+	if exit != 1 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 1)
+	}
+	if !strings.Contains(output, "kestrelret") || strings.Contains(output, "pw1001") {
+		t.Errorf("got '%v', want kestrelret instructions without the password", output)
+	}
+	jobs, err := listJobs(jobsFile())
+	if len(jobs) != 1 || err != nil || jobs[0].Number != 1001 || jobs[0].Password != "pw1001" {
+		t.Errorf("got '%v', '%v', want job 1001 queued", jobs, err)
+	}
+}
+
+func TestFakeRunQueue(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Lifecycle = neostest.Lifecycle{Steps: []neostest.Step{{Status: "Waiting"}, {Status: "Done"}}}
+	// A job of another user, then one of the session
+	if _, err := submit(context.Background(), stub, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeJob(jobsFile(), 1001); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := submit(context.Background(), stub, ""); err != nil {
+		t.Fatal(err)
+	}
+	var exit int
+	var err error
+	output := captureOutput(t, func() {
+		exit, err = run([]string{"kestrel", "queue"})
+	})
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	for _, want := range []string{"0 running, 2 waiting", "  #1001", "* #1002"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("got '%v', want '%v' in the output", output, want)
+		}
+	}
+}
+
+func TestFakeSolveQueuePosition(t *testing.T) {
+	srv, stub := startNEOS(t)
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps:    []neostest.Step{{Status: "Waiting"}, {Status: "Waiting"}, {Status: "Waiting"}, {Status: "Done"}},
+		Solution: neostest.DefaultLifecycle.Solution,
+	}
+	var exit int
+	var err error
+	output := captureOutput(t, func() {
+		exit, err = solve(context.Background(), stub)
+	})
+	if exit != 0 || err != nil {
+		t.Fatalf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	// Printed once while the position does not change
+	if n := strings.Count(output, "Job 1001 is waiting, position 1 in the NEOS queue"); n != 1 {
+		t.Errorf("got '%v', want the queue position once", output)
+	}
+	// Looked up once until the next heartbeat
+	if n := srv.Calls("printQueue"); n != 1 {
+		t.Errorf("got %d printQueue calls, want 1", n)
+	}
+}
@@ -1,100 +1,126 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"io"
-	"io/fs"
-	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
+
+	"ampl/gokestrel/neos/kestrel"
 )
 
 var Version = "development"
 
-type Job = struct {
-	jobNumber int
-	password  string
+// pollStart is the delay before the first status check while kestrel waits
+// for a job. The delay grows with each check that brings no new output, up
+// to pollInterval unless kestrel_options has poll=<seconds>, and starts over
+// when output arrives.
+var (
+	pollStart    = time.Second
+	pollInterval = 15 * time.Second
+)
+
+// poller spaces out the status checks of a job.
+type poller struct {
+	delay, max time.Duration
 }
 
-func listJobs(jobsFile string) ([]Job, error) {
-	f, err := os.Open(jobsFile)
-	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
-			return nil, nil
-		}
-		return nil, err
+func newPoller() *poller {
+	max := pollInterval
+	if poll := getKestrelOptions().Poll; poll > 0 {
+		max = poll
 	}
-	defer f.Close()
-	jobs := []Job{}
-	for {
-		job := Job{}
-		_, err := fmt.Fscanf(f, "%d %s", &job.jobNumber, &job.password)
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return nil, err
-		}
-		jobs = append(jobs, job)
-	}
-	return jobs, nil
+	p := &poller{max: max}
+	p.reset()
+	return p
 }
 
-func writeJobs(jobs []Job, jobsFile string) error {
-	if len(jobs) == 0 {
-		if err := os.Remove(jobsFile); err != nil {
-			return err
-		}
+func (p *poller) reset() {
+	p.delay = pollStart
+	if p.delay > p.max {
+		p.delay = p.max
 	}
-	f, err := os.Create(jobsFile)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	for _, job := range jobs {
-		if _, err := fmt.Fprintf(f, "%d %s\n", job.jobNumber, job.password); err != nil {
-			defer os.Remove(jobsFile)
-			return err
-		}
+}
+
+// next returns the delay before the next check, shorter if the last check
+// brought progress.
+func (p *poller) next(progress bool) time.Duration {
+	if progress {
+		p.reset()
+	} else if p.delay = p.delay * 3 / 2; p.delay > p.max {
+		p.delay = p.max
 	}
-	return nil
+	return p.delay
 }
 
-func submit(stub string) (int, error) {
+func submit(ctx context.Context, stub string, name string) (int, error) {
 	stub = strings.TrimSuffix(stub, ".nl")
-	k, err := NewKestrel()
+	// Remember where the model is so that retrieve writes the solution next to it
+	absStub, err := filepath.Abs(stub)
 	if err != nil {
 		return 1, err
 	}
-	fmt.Printf("Submitting model at %s\n", stub+".nl")
-	xml, err := k.formXML(stub)
+	k, err := NewKestrel(ctx)
 	if err != nil {
 		return 1, err
 	}
-	jobNumber, password, err := k.submit(xml)
+	fmt.Printf("Submitting model at %s\n", stub+".nl")
+	submission, err := k.submission(ctx, stub)
 	if err != nil {
 		return 1, err
 	}
-	// Add the job, pass to the stack
-	fname := jobsFile()
-	jobs, err := listJobs(fname)
+	jobNumber, password, err := k.submit(ctx, submission)
 	if err != nil {
 		return 1, err
 	}
-	jobs = append(jobs, Job{jobNumber, password})
-	err = writeJobs(jobs, fname)
-	if err != nil {
+	// Add the job, pass to the stack
+	if err := queueJob(newJob(k, submission, absStub, jobNumber, password, name)); err != nil {
 		return 1, err
 	}
 	return 0, nil
 }
 
-func retrieve(stub string) (int, error) {
+// newJob returns the session job queue record of a job submitted from
+// absStub. submission is nil for a job resumed from kestrel_options, whose
+// submission time is unknown.
+func newJob(k *Kestrel, submission *kestrel.Submission, absStub string, jobNumber int, password string, name string) Job {
+	job := Job{
+		Number:   jobNumber,
+		Password: password,
+		Stub:     absStub,
+		Server:   fmt.Sprintf("%s:%s", k.Host, k.Port),
+		Status:   "Submitted",
+		Name:     name,
+	}
+	if submission != nil {
+		job.Solver, job.Priority, job.Submitted = submission.Solver, submission.Priority, time.Now()
+	} else {
+		job.Solver, job.Priority = getKestrelOptions().Solver, getPriority()
+	}
+	return job
+}
+
+// queueJob adds job to the session job queue unless it is already queued.
+func queueJob(job Job) error {
+	return updateJobs(jobsFile(), func(jobs []Job) ([]Job, error) {
+		if findJob(jobs, job.Number, "") >= 0 {
+			return jobs, nil
+		}
+		return append(jobs, job), nil
+	})
+}
+
+// retrieve writes the solution of a queued job and removes it from the queue.
+// The job is selected by jobNumber or name when set, otherwise the oldest
+// job is taken. The solution is written next to the model the job was
+// submitted from unless stub is set, and only if it fits that model unless
+// force is set.
+func retrieve(ctx context.Context, stub string, jobNumber int, name string, force bool) (int, error) {
 	fname := jobsFile()
 	jobs, err := listJobs(fname)
 	if err != nil {
@@ -105,129 +131,559 @@ func retrieve(stub string) (int, error) {
 		fmt.Printf("Did you use kestrelsub?\n")
 		return 1, nil
 	}
-	k, err := NewKestrel()
+	i := findJob(jobs, jobNumber, name)
+	if i < 0 {
+		if jobNumber != 0 {
+			return 1, fmt.Errorf("Error, job %d is not queued in %s.", jobNumber, fname)
+		}
+		return 1, fmt.Errorf("Error, no job named '%s' is queued in %s.", name, fname)
+	}
+	job := jobs[i]
+	stub = solutionStub(stub, job)
+	k, err := NewKestrel(ctx)
 	if err != nil {
 		return 1, err
 	}
-	if err := k.retrieve(stub, jobs[0].jobNumber, jobs[0].password); err != nil {
+	exit, err := k.retrieve(ctx, stub, job.Number, job.Password, force)
+	if err != nil {
+		return exit, err
+	}
+	if err := removeJob(fname, job.Number); err != nil {
 		return 1, err
 	}
-	if len(jobs) > 1 {
+	jobs = append(jobs[:i], jobs[i+1:]...)
+	if len(jobs) > 0 {
 		fmt.Println("restofstack: ")
-		for _, job := range jobs[1:] {
-			fmt.Printf("%d %s\n", job.jobNumber, job.password)
+		for _, job := range jobs {
+			fmt.Printf("%d %s\n", job.Number, redacted(job.Password))
+		}
+	}
+	return exit, nil
+}
+
+// solutionStub returns the stub the solution of job is written to: stub when
+// set explicitly, with a warning if job was submitted from another model,
+// otherwise the stub recorded at submission or the default one.
+func solutionStub(stub string, job Job) string {
+	if stub == "" {
+		if job.Stub != "" {
+			return job.Stub
+		}
+		return getStub()
+	}
+	stub = strings.TrimSuffix(stub, ".nl")
+	if absStub, err := filepath.Abs(stub); err == nil && job.Stub != "" && absStub != job.Stub {
+		fmt.Printf("Warning, job %d was submitted from %s.nl, writing its solution to %s.sol\n",
+			job.Number, job.Stub, stub)
+	}
+	return stub
+}
+
+func kill(ctx context.Context, jobNumber int, password string) (int, error) {
+	k, err := NewKestrel(ctx)
+	if err != nil {
+		return 1, err
+	}
+	err = k.kill(ctx, jobNumber, password)
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// fetch downloads output files written by a job on NEOS, once the job has
+// finished, next to the stub it was submitted from when it is queued or
+// next to the default stub otherwise.
+func fetch(ctx context.Context, jobNumber int, password string, names []string) (int, error) {
+	for _, name := range names {
+		if err := checkOutputFile(name); err != nil {
+			return 1, fmt.Errorf("Error, %v.", err)
+		}
+	}
+	stub := getStub()
+	if jobs, err := listJobs(jobsFile()); err == nil {
+		if i := findJob(jobs, jobNumber, ""); i >= 0 && jobs[i].Stub != "" {
+			stub = jobs[i].Stub
 		}
 	}
-	if err := writeJobs(jobs[1:], fname); err != nil {
+	k, err := NewKestrel(ctx)
+	if err != nil {
+		return 1, err
+	}
+	p := newPoller()
+	for announced := false; ; announced = true {
+		status, err := k.getJobStatus(ctx, jobNumber, password)
+		if err != nil {
+			return 1, err
+		}
+		if status == kestrel.StatusDone {
+			break
+		} else if !status.Active() {
+			return 1, fmt.Errorf("Error, job %d: %s", jobNumber, status)
+		}
+		if !announced {
+			fmt.Printf("Waiting for job %d to finish\n", jobNumber)
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println("Keyboard Interrupt")
+			return 1, nil
+		case <-time.After(p.next(false)):
+		}
+	}
+	if err := k.fetchOutputs(ctx, stub, kestrel.Job{Number: jobNumber, Password: password}, names); err != nil {
 		return 1, err
 	}
 	return 0, nil
 }
 
-func kill(jobNumber int, password string) (int, error) {
-	k, err := NewKestrel()
+// wait streams the output of the given job, or of the oldest queued job when
+// jobNumber is 0, and writes its solution. With all set, every queued job is
+// waited for in turn. Queued jobs, including a given job that is queued, are
+// written next to their own stub and removed from the queue once retrieved.
+func wait(ctx context.Context, stub string, jobNumber int, password string, all bool) (int, error) {
+	fname := jobsFile()
+	jobs := []Job{{Number: jobNumber, Password: password, Stub: stub}}
+	queued := jobNumber == 0
+	if jobNumber != 0 {
+		if queue, err := listJobs(fname); err == nil {
+			if i := findJob(queue, jobNumber, ""); i >= 0 {
+				queued = true
+				if queue[i].Stub != "" {
+					jobs[0].Stub = queue[i].Stub
+				}
+			}
+		}
+	} else {
+		var err error
+		jobs, err = listJobs(fname)
+		if err != nil {
+			return 1, err
+		}
+		if len(jobs) == 0 {
+			fmt.Printf("Error, could not open file %s.\n", fname)
+			fmt.Printf("Did you use kestrelsub?\n")
+			return 1, nil
+		}
+		if !all {
+			jobs = jobs[:1]
+		}
+	}
+	k, err := NewKestrel(ctx)
 	if err != nil {
 		return 1, err
 	}
-	err = k.kill(jobNumber, password)
+	exit := 0
+	for _, job := range jobs {
+		jobStub := job.Stub
+		if jobStub == "" {
+			jobStub = stub
+		}
+		fmt.Printf("Waiting for job %d (%s.nl)\n", job.Number, strings.TrimSuffix(jobStub, ".nl"))
+		jobExit, err := watch(ctx, k, jobStub, job.Number, job.Password)
+		if err != nil || jobExit == 1 {
+			// The job was not retrieved
+			return jobExit, err
+		}
+		if exit == 0 {
+			exit = jobExit
+		}
+		if queued {
+			if err := removeJob(fname, job.Number); err != nil {
+				return 1, err
+			}
+		}
+	}
+	return exit, nil
+}
+
+// status prints the NEOS status of the given job, or of every job queued in
+// the session jobs file when jobNumber is 0.
+func status(ctx context.Context, jobNumber int, password string) (int, error) {
+	fname := jobsFile()
+	jobs := []Job{{Number: jobNumber, Password: password}}
+	if jobNumber == 0 {
+		var err error
+		jobs, err = listJobs(fname)
+		if err != nil {
+			return 1, err
+		}
+		if len(jobs) == 0 {
+			fmt.Printf("No jobs queued in %s.\n", fname)
+			fmt.Printf("Did you use kestrelsub?\n")
+			return 0, nil
+		}
+	}
+	k, err := NewKestrel(ctx)
+	if err != nil {
+		return 1, err
+	}
+	for i := range jobs {
+		status, err := k.getJobStatus(ctx, jobs[i].Number, jobs[i].Password)
+		if err != nil {
+			return 1, err
+		}
+		jobs[i].Status = string(status)
+	}
+	printJobs(jobs, time.Now())
+	if jobNumber != 0 {
+		return 0, nil
+	}
+	err = updateJobs(fname, func(queued []Job) ([]Job, error) {
+		for i := range queued {
+			for _, job := range jobs {
+				if queued[i].Number == job.Number {
+					queued[i].Status = job.Status
+				}
+			}
+		}
+		return queued, nil
+	})
 	if err != nil {
 		return 1, err
 	}
 	return 0, nil
 }
 
-func solve(stub string, sigint chan os.Signal) (int, error) {
-	k, err := NewKestrel()
+// queue prints the jobs running and waiting on NEOS, marking those of the
+// session job queue with "*".
+func queue(ctx context.Context) (int, error) {
+	k, err := NewKestrel(ctx)
 	if err != nil {
 		return 1, err
 	}
-	jobNumber := 0
-	password := ""
-	errors := make(chan error)
-	go func() {
-		// See if kestrel_options has job=.. password=..
-		jobNumber, password = getJobAndPassword()
-		// otherwise, submit current problem to NEOS
-		if jobNumber == 0 {
-			xml, err := k.formXML(stub)
-			if err != nil {
-				errors <- err
-				return
+	text, err := k.Queue(ctx)
+	if err != nil {
+		return 1, err
+	}
+	q := kestrel.ParseQueue(text)
+	mine := map[int]bool{}
+	if jobs, err := listJobs(jobsFile()); err == nil {
+		for _, job := range jobs {
+			mine[job.Number] = true
+		}
+	} else {
+		fmt.Printf("Warning, could not read the job queue: %v\n", err)
+	}
+	fmt.Printf("NEOS queue: %d running, %d waiting\n", len(q.Running), len(q.Waiting))
+	for _, section := range []struct {
+		title   string
+		entries []kestrel.QueueEntry
+	}{{"Running", q.Running}, {"Waiting", q.Waiting}} {
+		if len(section.entries) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", section.title)
+		for _, entry := range section.entries {
+			mark := " "
+			if mine[entry.Job] {
+				mark = "*"
 			}
-			jobNumber, password, err = k.submit(xml)
-			if err != nil {
-				errors <- err
-				return
+			fmt.Printf("%s %s\n", mark, entry.Line)
+		}
+	}
+	if len(mine) > 0 {
+		fmt.Printf("* job of the session job queue\n")
+	}
+	return 0, nil
+}
+
+func printInterrupted(jobNumber int, password string) {
+	fmt.Printf("Keyboard Interrupt\n")
+	printResume(jobNumber, password)
+}
+
+// resumeOptions returns the kestrel_options selecting a job.
+func resumeOptions(jobNumber int, password string) string {
+	if redactPasswords() {
+		// The password is looked up in the job queue
+		return fmt.Sprintf("job=%d", jobNumber)
+	}
+	return fmt.Sprintf("job=%d password=%s", jobNumber, password)
+}
+
+func printResume(jobNumber int, password string) {
+	fmt.Printf("Job is still running on remote machine\n")
+	options := resumeOptions(jobNumber, password)
+	fmt.Printf("To stop job:\n")
+	fmt.Printf("\tampl: option kestrel_options \"%s\";\n", options)
+	fmt.Printf("\tampl: commands kestrelkill;\n")
+	fmt.Printf("To retrieve results:\n")
+	fmt.Printf("\tampl: option kestrel_options \"%s\";\n", options)
+	fmt.Printf("\tampl: solve;\n")
+}
+
+// solve submits stub, or resumes the job given in kestrel_options, and
+// streams its output until it finishes, or waits for it with waitLong when it
+// has long priority. Cancelling ctx stops waiting for the job, which keeps
+// running on NEOS.
+func solve(ctx context.Context, stub string) (int, error) {
+	k, err := NewKestrel(ctx)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Println("Keyboard Interrupt while submitting problem.")
+			return 1, nil
+		}
+		return 1, err
+	}
+	absStub, err := filepath.Abs(stub)
+	if err != nil {
+		return 1, err
+	}
+	// See if kestrel_options has job=.. password=..
+	jobNumber, password := getJobAndPassword()
+	var submission *kestrel.Submission
+	// otherwise, submit current problem to NEOS
+	if jobNumber == 0 {
+		submission, err = k.submission(ctx, stub)
+		if err == nil {
+			jobNumber, password, err = k.submit(ctx, submission)
+		}
+		if jobNumber != 0 && redactPasswords() {
+			// Keep the password, which is not printed, for resuming or killing the
+			// job, even when interrupted right after it was submitted
+			if err := queueJob(newJob(k, submission, absStub, jobNumber, password, "")); err != nil {
+				return 1, err
 			}
 		}
-		errors <- nil
-	}()
-	select {
-	case <-sigint:
-		fmt.Println("Keyboard Interrupt while submitting problem.")
-		return 1, nil
-	case err := <-errors:
+		if ctx.Err() != nil {
+			fmt.Println("Keyboard Interrupt while submitting problem.")
+			if jobNumber != 0 {
+				printResume(jobNumber, password)
+			}
+			return 1, nil
+		}
 		if err != nil {
 			return 1, err
 		}
 	}
-	offset := 0
+	var exit int
+	detached := false
+	if getPriority() == "long" {
+		job := newJob(k, submission, absStub, jobNumber, password, getJobName())
+		exit, detached, err = waitLong(ctx, k, stub, job)
+	} else {
+		exit, err = watch(ctx, k, stub, jobNumber, password)
+	}
+	if exit != 1 && !detached && redactPasswords() {
+		if err := removeJob(jobsFile(), jobNumber); err != nil {
+			return 1, err
+		}
+	}
+	if exit != 1 && err == nil {
+		// AMPL only reads the .sol file of a solve that exits normally, and
+		// the .sol file written for a job without a solution tells what happened
+		exit = 0
+	}
+	return exit, err
+}
+
+// watch streams the output of a job until it is no longer queued or running,
+// then retrieves its solution into stub. While the job is waiting, its
+// position in the NEOS queue is printed whenever it changes. The position is
+// looked up when the job starts waiting, then once per heartbeatInterval, as
+// printQueue lists every job on NEOS.
+func watch(ctx context.Context, k *Kestrel, stub string, jobNumber int, password string) (int, error) {
+	var err error
+	offset, position := 0, 0
+	var positionChecked time.Time
 	output := ""
-	status := "Running"
-	time.Sleep(1 * time.Second)
-	for status == "Running" || status == "Waiting" {
-		output, offset, err = k.getIntermediateResults(jobNumber, password, offset)
-		if err != nil {
-			log.Println(err)
+	status := kestrel.StatusRunning
+	p := newPoller()
+	delay := p.delay
+	for status.Active() {
+		select {
+		case <-ctx.Done():
+			printInterrupted(jobNumber, password)
+			return 1, nil
+		case <-time.After(delay):
 		}
+		output, offset, err = k.getIntermediateResults(ctx, jobNumber, password, offset)
 		fmt.Printf("%s", output)
-		status, err = k.getJobStatus(jobNumber, password)
+		delay = p.next(output != "")
+		if err == nil {
+			status, err = k.getJobStatus(ctx, jobNumber, password)
+		}
+		if ctx.Err() != nil {
+			printInterrupted(jobNumber, password)
+			return 1, nil
+		}
 		if err != nil {
-			log.Println(err)
+			// Retries are exhausted, the job state is unknown: do not retrieve
+			printResume(jobNumber, password)
+			return 1, fmt.Errorf("Error, lost connection to NEOS while waiting for job %d: %v", jobNumber, err)
+		}
+		if status != kestrel.StatusWaiting {
+			positionChecked = time.Time{}
+		} else if positionChecked.IsZero() || time.Since(positionChecked) >= heartbeatInterval {
+			positionChecked = time.Now()
+			if n := k.getQueuePosition(ctx, jobNumber); n > 0 && n != position {
+				fmt.Printf("Job %d is waiting, position %d in the NEOS queue\n", jobNumber, n)
+				position = n
+			}
+		}
+	}
+	if status != kestrel.StatusDone {
+		return 1, fmt.Errorf("Error, job %d: %s", jobNumber, status)
+	}
+	// Output written as the job finished
+	if output, _, err := k.getIntermediateResults(ctx, jobNumber, password, offset); err == nil {
+		fmt.Printf("%s", output)
+	}
+	return k.retrieve(ctx, stub, jobNumber, password, false)
+}
+
+// heartbeatInterval is how often waitLong reports on a job.
+var heartbeatInterval = time.Minute
+
+// waitLong waits for a long priority job, whose output NEOS does not stream,
+// by checking its status only, and prints a heartbeat with the elapsed time
+// and the position of the job in the NEOS queue. When interrupted, or when
+// the connection to NEOS is lost, it detaches the job into the session job
+// queue for kestrelret to retrieve; detach=1 in kestrel_options detaches it
+// right away. It returns whether the job was detached.
+func waitLong(ctx context.Context, k *Kestrel, stub string, job Job) (int, bool, error) {
+	fmt.Printf("Job %d has long priority: its output is not streamed.\n", job.Number)
+	if getKestrelOptions().Detach {
+		if err := detach(job); err != nil {
+			return 1, false, err
 		}
+		// AMPL reads the .sol file of a solve that exits normally, where
+		// solve_result_num 540 tells scripts that there is no solution yet
+		message := fmt.Sprintf("kestrel: NEOS job %d detached, retrieve it with kestrelret", job.Number)
+		if err := writeFailureSolution(stub, 540, message); err != nil {
+			return 1, true, err
+		}
+		return 0, true, nil
+	}
+	fmt.Printf("Press Ctrl-C to stop waiting, the job will be queued for kestrelret.\n")
+	start := time.Now()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	var err error
+	status := kestrel.StatusWaiting
+	p := newPoller()
+	poll := time.NewTimer(p.delay)
+	defer poll.Stop()
+	for status.Active() {
 		select {
-		case <-sigint:
+		case <-ctx.Done():
 			fmt.Printf("Keyboard Interrupt\n")
-			fmt.Printf("Job is still running on remote machine\n")
-			fmt.Printf("To stop job:\n")
-			fmt.Printf("\tampl: option kestrel_options \"job=%d password=%s\";\n", jobNumber, password)
-			fmt.Printf("\tampl: commands kestrelkill;\n")
-			fmt.Printf("To retrieve results:\n")
-			fmt.Printf("\tampl: option kestrel_options \"job=%d password=%s\";\n", jobNumber, password)
-			fmt.Printf("\tampl: solve;\n")
-			return 1, nil
-		case <-time.After(5 * time.Second):
+			return 1, true, detach(job)
+		case <-heartbeat.C:
+			printHeartbeat(ctx, k, job.Number, status, time.Since(start))
+			continue
+		case <-poll.C:
+		}
+		previous := status
+		status, err = k.getJobStatus(ctx, job.Number, job.Password)
+		if ctx.Err() != nil {
+			fmt.Printf("Keyboard Interrupt\n")
+			return 1, true, detach(job)
 		}
+		if err != nil {
+			// Retries are exhausted, the job state is unknown: do not retrieve
+			if err := detach(job); err != nil {
+				return 1, true, err
+			}
+			return 1, true, fmt.Errorf("Error, lost connection to NEOS while waiting for job %d: %v", job.Number, err)
+		}
+		poll.Reset(p.next(status != previous))
 	}
-	err = k.retrieve(stub, jobNumber, password)
-	if err != nil {
-		return 1, err
+	if status != kestrel.StatusDone {
+		return 1, false, fmt.Errorf("Error, job %d: %s", job.Number, status)
 	}
-	return 0, nil
+	fmt.Printf("Job %d done after %s\n", job.Number, formatAge(time.Since(start)))
+	exit, err := k.retrieve(ctx, stub, job.Number, job.Password, false)
+	return exit, false, err
+}
+
+// printHeartbeat reports the status of a job waited for with waitLong, with
+// its position in the NEOS queue while it is waiting.
+func printHeartbeat(ctx context.Context, k *Kestrel, jobNumber int, status kestrel.Status, elapsed time.Duration) {
+	position := ""
+	if status == kestrel.StatusWaiting {
+		if n := k.getQueuePosition(ctx, jobNumber); n > 0 {
+			position = fmt.Sprintf(", position %d in the NEOS queue", n)
+		}
+	}
+	fmt.Printf("[%s] Job %d: %s%s\n", formatAge(elapsed), jobNumber, status, position)
+}
+
+// detach adds job, which keeps running on NEOS, to the session job queue and
+// tells how to retrieve it.
+func detach(job Job) error {
+	if err := queueJob(job); err != nil {
+		return err
+	}
+	fmt.Printf("Job %d is still running on remote machine and was added to the job queue\n", job.Number)
+	if getEnvOption("ampl_id") == "" {
+		fmt.Printf("Warning, ampl_id is not set, run \"option ampl_id (_pid);\" before solve for kestrelret to find the job\n")
+	}
+	fmt.Printf("To stop job:\n")
+	fmt.Printf("\tampl: option kestrel_options \"%s\";\n", resumeOptions(job.Number, job.Password))
+	fmt.Printf("\tampl: commands kestrelkill;\n")
+	fmt.Printf("To retrieve results once it is done:\n")
+	fmt.Printf("\tampl: commands kestrelret;\n")
+	return nil
 }
 
 func run(args []string) (int, error) {
+	// SIGINT cancels in-flight NEOS calls
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// The version is printed even when the configuration is broken
 	if len(args) == 2 && (args[1] == "-v" || args[1] == "version") {
 		fmt.Printf("kestrel version %v %v/%v\n", Version, runtime.GOOS, runtime.GOARCH)
 		return 0, nil
-	} else if len(args) >= 2 && len(args) <= 3 && args[1] == "submit" {
-		stub := getEnvOption("kestrel_stub")
-		if stub == "" {
-			stub = "kmodel"
+	}
+	if err := loadConfig(); err != nil {
+		return 1, err
+	}
+	if len(args) < 2 || args[1] != "config" {
+		// kestrel config show still works, to find out where the options come from
+		if err := checkOptions(); err != nil {
+			return 1, err
 		}
-		if len(args) == 3 {
-			stub = args[2]
+	}
+	if len(args) >= 2 && args[1] == "submit" {
+		flags, params, err := parseFlags(args[2:], map[string]bool{"name": true})
+		if err != nil || len(params) > 1 {
+			fmt.Println("usage: kestrel submit [stub] [--name NAME]")
+			return 1, err
+		}
+		stub := getStub()
+		if len(params) == 1 {
+			stub = params[0]
+		}
+		name, ok := flags["name"]
+		if !ok {
+			name = getJobName()
+		}
+		return submit(ctx, stub, name)
+	} else if len(args) >= 2 && args[1] == "retrieve" {
+		flags, params, err := parseFlags(args[2:], map[string]bool{"job": true, "name": true, "force": false})
+		if err != nil || len(params) > 1 {
+			fmt.Println("usage: kestrel retrieve [stub] [--job NUMBER | --name NAME] [--force]")
+			return 1, err
 		}
-		return submit(stub)
-	} else if len(args) >= 2 && len(args) <= 3 && args[1] == "retrieve" {
 		stub := getEnvOption("kestrel_stub")
-		if stub == "" {
-			stub = "kmodel"
+		if len(params) == 1 {
+			stub = params[0]
 		}
-		if len(args) == 3 {
-			stub = args[2]
+		jobNumber := 0
+		if v, ok := flags["job"]; ok {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				return 1, err
+			}
+			jobNumber = int(n)
 		}
-		return retrieve(stub)
+		_, force := flags["force"]
+		return retrieve(ctx, stub, jobNumber, flags["name"], force)
 	} else if (len(args) == 2 || len(args) == 4) && args[1] == "kill" {
 		jobNumber, password := getJobAndPassword()
 		if len(args) == 4 {
@@ -242,11 +698,61 @@ func run(args []string) (int, error) {
 			fmt.Println("\tampl: option kestrel_options \"job=#### password=xxxx\";")
 			return 1, nil
 		}
-		return kill(jobNumber, password)
+		return kill(ctx, jobNumber, password)
+	} else if len(args) >= 2 && args[1] == "solvers" {
+		flags, params, err := parseFlags(args[2:], map[string]bool{"refresh": false})
+		if err != nil || len(params) > 0 {
+			fmt.Println("usage: kestrel solvers [--refresh]")
+			return 1, err
+		}
+		_, refresh := flags["refresh"]
+		return solvers(ctx, refresh)
+	} else if len(args) >= 2 && args[1] == "fetch" {
+		if len(args) < 5 {
+			fmt.Println("usage: kestrel fetch JOB PASSWORD FILE...")
+			return 1, nil
+		}
+		n, err := strconv.ParseInt(args[2], 10, 32)
+		if err != nil {
+			return 1, err
+		}
+		return fetch(ctx, int(n), args[3], args[4:])
+	} else if len(args) == 2 && args[1] == "queue" {
+		return queue(ctx)
+	} else if len(args) == 2 && args[1] == "login" {
+		return login()
+	} else if len(args) == 2 && args[1] == "logout" {
+		return logout()
+	} else if len(args) >= 2 && args[1] == "config" {
+		if len(args) != 3 || args[2] != "show" {
+			fmt.Println("usage: kestrel config show")
+			return 1, nil
+		}
+		return showConfig()
+	} else if (len(args) == 2 || len(args) == 4) && args[1] == "status" {
+		jobNumber, password := 0, ""
+		if len(args) == 4 {
+			n, err := strconv.ParseInt(args[2], 10, 32)
+			if err != nil {
+				return 1, err
+			}
+			jobNumber = int(n)
+			password = args[3]
+		}
+		return status(ctx, jobNumber, password)
+	} else if (len(args) == 2 || len(args) == 4 || (len(args) == 3 && args[2] == "--all")) && args[1] == "wait" {
+		jobNumber, password := 0, ""
+		if len(args) == 4 {
+			n, err := strconv.ParseInt(args[2], 10, 32)
+			if err != nil {
+				return 1, err
+			}
+			jobNumber = int(n)
+			password = args[3]
+		}
+		return wait(ctx, getStub(), jobNumber, password, len(args) == 3)
 	} else if len(args) == 3 && args[2] == "-AMPL" {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		return solve(args[1], sigint)
+		return solve(ctx, args[1])
 	}
 	fmt.Println("kestrel should be called from inside AMPL.")
 	return 1, nil
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"math"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func getEnv(alternatives ...string) string {
@@ -27,43 +30,341 @@ func getEnvOption(option string) string {
 }
 
 func getOptions() string {
-	return getEnvOption("kestrel_options")
+	return getSetting("kestrel_options")
 }
 
-var jobNumberRgx = regexp.MustCompile(`job\s*=\s*(\d+)`)
-var jobPasswordRgx = regexp.MustCompile(`password\s*=\s*(\S+)`)
+func getStub() string {
+	/*
+		Stub used by kestrel submit/retrieve, kmodel unless kestrel_stub is set
+	*/
+	if stub := getEnvOption("kestrel_stub"); stub != "" {
+		return stub
+	}
+	return "kmodel"
+}
+
+// Options holds the settings given in kestrel_options, such as
+// "solver=cplex priority=long".
+type Options struct {
+	Solver   string
+	Priority string        // short or long
+	Timeout  time.Duration // NEOS call timeout, none if zero
+	Poll     time.Duration // longest delay between status checks, default if zero
+	Job      int           // job to resume, retrieve or kill
+	Password string
+	Name     string // name given to submitted jobs
+	Redact   string // whether to mask job passwords, as given
+	Outputs  string // comma separated output files to fetch with the solution
+	Detach   bool   // whether solve queues long priority jobs instead of waiting
+}
+
+// OutputFiles returns the names of the output files listed in o.Outputs.
+func (o Options) OutputFiles() []string {
+	names := []string{}
+	for _, name := range strings.Split(o.Outputs, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// minPoll is the shortest poll accepted, to spare the NEOS server.
+const minPoll = time.Second
+
+// optionKeywords lists the keywords of kestrel_options, with whether they
+// may be given without a value.
+var optionKeywords = map[string]bool{
+	"solver":   false,
+	"priority": false,
+	"timeout":  false,
+	"poll":     false,
+	"job":      false,
+	"password": false,
+	"name":     false,
+	"redact":   true,
+	"outputs":  false,
+	"detach":   true,
+}
+
+// parseOptions parses kestrel_options. Keywords are case insensitive and
+// separated by spaces from each other, and by "=" or spaces from their
+// values, which can be quoted. Unknown keywords are returned as warnings;
+// invalid values are skipped and reported by the error.
+func parseOptions(s string) (Options, []string, error) {
+	options := Options{Priority: "short"}
+	warnings := []string{}
+	var errs []string
+	tokens, err := optionTokens(s)
+	if err != nil {
+		return options, warnings, err
+	}
+	for i := 0; i < len(tokens); {
+		keyword := strings.ToLower(tokens[i])
+		bare, known := optionKeywords[keyword]
+		value, hasValue := "", false
+		if i+2 < len(tokens) && tokens[i+1] == "=" {
+			value, hasValue = tokens[i+2], true
+			i += 3
+		} else if i+1 < len(tokens) && tokens[i+1] == "=" {
+			errs = append(errs, fmt.Sprintf("missing value for '%s'", tokens[i]))
+			i += 2
+			continue
+		} else if known && !bare && i+1 < len(tokens) && tokens[i+1] != "=" &&
+			(i+2 == len(tokens) || tokens[i+2] != "=") {
+			// AMPL style "keyword value"
+			value, hasValue = tokens[i+1], true
+			i += 2
+		} else {
+			i++
+		}
+		if !known {
+			warnings = append(warnings, fmt.Sprintf("unknown keyword '%s' in kestrel_options ignored", keyword))
+			continue
+		}
+		if !hasValue && !bare {
+			errs = append(errs, fmt.Sprintf("missing value for '%s'", keyword))
+			continue
+		}
+		if err := options.set(keyword, value, hasValue); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return options, warnings, fmt.Errorf("Error, invalid kestrel_options: %s.", strings.Join(errs, "; "))
+	}
+	return options, warnings, nil
+}
+
+func (o *Options) set(keyword, value string, hasValue bool) error {
+	switch keyword {
+	case "solver":
+		o.Solver = value
+	case "priority":
+		priority := strings.ToLower(value)
+		if priority != "short" && priority != "long" {
+			return fmt.Errorf("priority '%s' is not short or long", value)
+		}
+		o.Priority = priority
+	case "timeout":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("timeout '%s' is not a number of seconds", value)
+		}
+		o.Timeout = time.Duration(v * float64(time.Second))
+	case "poll":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < minPoll.Seconds() || math.IsInf(v, 0) || math.IsNaN(v) {
+			return fmt.Errorf("poll '%s' is not a number of seconds of at least %g", value, minPoll.Seconds())
+		}
+		o.Poll = time.Duration(v * float64(time.Second))
+	case "job":
+		v, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("job '%s' is not a job number", value)
+		}
+		o.Job = int(v)
+	case "password":
+		o.Password = value
+	case "name":
+		o.Name = value
+	case "redact":
+		if !hasValue {
+			value = "1"
+		}
+		if _, err := parseBool(value); err != nil {
+			return fmt.Errorf("redact '%s' is not 0 or 1", value)
+		}
+		o.Redact = value
+	case "outputs":
+		for _, name := range strings.Split(value, ",") {
+			if err := checkOutputFile(strings.TrimSpace(name)); err != nil {
+				return err
+			}
+		}
+		o.Outputs = value
+	case "detach":
+		if !hasValue {
+			value = "1"
+		}
+		detach, err := parseBool(value)
+		if err != nil {
+			return fmt.Errorf("detach '%s' is not 0 or 1", value)
+		}
+		o.Detach = detach
+	}
+	return nil
+}
+
+// checkOutputFile rejects output file names that would be written outside of
+// the directory of the stub.
+func checkOutputFile(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) {
+		return fmt.Errorf("output file '%s' is not a file name", name)
+	}
+	return nil
+}
+
+// optionTokens splits s into words, "=" signs and quoted strings.
+func optionTokens(s string) ([]string, error) {
+	spans, err := optionSpans(s)
+	if err != nil {
+		return nil, err
+	}
+	tokens := []string{}
+	for _, span := range spans {
+		tokens = append(tokens, optionToken(s, span))
+	}
+	return tokens, nil
+}
+
+// optionSpans returns the start and end offsets of the tokens of s, quotes
+// included.
+func optionSpans(s string) ([][2]int, error) {
+	spans := [][2]int{}
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '=':
+			spans = append(spans, [2]int{i, i + 1})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("Error, invalid kestrel_options: unterminated string %s.", s[i:])
+			}
+			spans = append(spans, [2]int{i, i + end + 2})
+			i += end + 2
+		default:
+			end := strings.IndexAny(s[i:], " \t\n\r=\"'")
+			if end < 0 {
+				end = len(s) - i
+			}
+			spans = append(spans, [2]int{i, i + end})
+			i += end
+		}
+	}
+	return spans, nil
+}
+
+// optionToken returns the token of s at span, unquoted.
+func optionToken(s string, span [2]int) string {
+	token := s[span[0]:span[1]]
+	if c := token[0]; c == '"' || c == '\'' {
+		return token[1 : len(token)-1]
+	}
+	return token
+}
+
+// redactOptions returns kestrel_options s with the job password masked.
+func redactOptions(s string) string {
+	spans, err := optionSpans(s)
+	if err != nil {
+		// Where the password ends is unknown
+		return redactedPassword
+	}
+	masked := []string{}
+	end := 0
+	for i := 0; i < len(spans); i++ {
+		if strings.ToLower(optionToken(s, spans[i])) != "password" || (i > 0 && s[spans[i-1][0]:spans[i-1][1]] == "=") {
+			continue
+		}
+		j := i + 1
+		if j < len(spans) && s[spans[j][0]:spans[j][1]] == "=" {
+			j++
+		}
+		if j < len(spans) {
+			masked = append(masked, s[end:spans[j][0]], redactedPassword)
+			end, i = spans[j][1], j
+		}
+	}
+	return strings.Join(append(masked, s[end:]), "")
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean '%s'", s)
+}
+
+// getKestrelOptions returns the parsed kestrel_options, where invalid values
+// are left to their defaults; checkOptions reports them.
+func getKestrelOptions() Options {
+	options, _, _ := parseOptions(getOptions())
+	return options
+}
+
+// checkOptions prints the warnings about kestrel_options and returns an
+// error if it has invalid values.
+func checkOptions() error {
+	_, warnings, err := parseOptions(getOptions())
+	for _, warning := range warnings {
+		fmt.Printf("Warning, %s.\n", warning)
+	}
+	return err
+}
 
 func getJobAndPassword() (int, string) {
 	/*
 		If kestrel_options is set to job/password, then return the job and password values
 	*/
-	jobNumber := 0
-	password := ""
-	options := getOptions()
-	if options != "" {
-		if match := jobNumberRgx.FindStringSubmatch(options); len(match) == 2 {
-			if v, err := strconv.ParseInt(match[1], 10, 32); err == nil {
-				jobNumber = int(v)
+	options := getKestrelOptions()
+	jobNumber, password := options.Job, options.Password
+	if jobNumber != 0 && (password == "" || password == redactedPassword) {
+		// The password of a job in the queue may be left out
+		if jobs, err := listJobs(jobsFile()); err == nil {
+			if i := findJob(jobs, jobNumber, ""); i >= 0 {
+				password = jobs[i].Password
 			}
 		}
-		if match := jobPasswordRgx.FindStringSubmatch(options); len(match) == 2 {
-			password = match[1]
-		}
 	}
 	return jobNumber, password
 }
 
-var priorityRgx = regexp.MustCompile(`priority\s*=\s*(\S+)`)
+func getJobName() string {
+	/*
+		If kestrel_options has name=..., then return the name given to submitted jobs
+	*/
+	return getKestrelOptions().Name
+}
 
 func getPriority() string {
-	options := getOptions()
-	if options == "" {
-		return "short"
+	return getKestrelOptions().Priority
+}
+
+// redactedPassword replaces job passwords in the output when redacting.
+const redactedPassword = "********"
+
+func redactPasswords() bool {
+	/*
+		If kestrel_options has redact=1, or kestrel_redact is set, then job passwords are not printed
+	*/
+	value := getKestrelOptions().Redact
+	if value == "" {
+		value = getSetting("kestrel_redact")
 	}
-	if match := priorityRgx.FindStringSubmatch(options); len(match) == 2 {
-		return match[1]
+	redact, _ := parseBool(value)
+	return redact
+}
+
+// redacted returns password, or a mask when job passwords are redacted.
+func redacted(password string) string {
+	if redactPasswords() {
+		return redactedPassword
 	}
-	return "short"
+	return password
+}
+
+func getTimeout() time.Duration {
+	/*
+		If kestrel_options has timeout=<seconds>, then return it as the NEOS call timeout
+	*/
+	return getKestrelOptions().Timeout
 }
 
 var neosServerPortRgx = regexp.MustCompile(`(\S+)\s*:\s*(\d+)`)
@@ -75,7 +376,7 @@ func getNEOSServer() (string, string) {
 	*/
 	host := "neos-server.org"
 	port := "3333"
-	options := getEnvOption("neos_server")
+	options := getSetting("neos_server")
 	if options != "" {
 		if match := neosServerPortRgx.FindStringSubmatch(options); len(match) == 3 {
 			return match[1], match[2]
@@ -90,15 +391,57 @@ func getEmail() string {
 	/*
 		Get email provided by user.
 	*/
-	email := getEnvOption("email")
+	email := getSetting("email")
 	return strings.TrimSpace(email)
 }
 
 func getAuthenticationOptions() (string, string) {
 	/*
-		If 'authenticate' is set to '"username", "password"', then return the authentication options
+		If 'authenticate' is set to '"username", "password"', then return the authentication options,
+		otherwise the credentials stored by kestrel login for the NEOS server
 	*/
-	username := getEnvOption("neos_username")
-	password := getEnvOption("neos_user_password")
-	return strings.TrimSpace(username), strings.TrimSpace(password)
+	username := strings.TrimSpace(getSetting("neos_username"))
+	password := strings.TrimSpace(getSetting("neos_user_password"))
+	if username == "" {
+		host, _ := getNEOSServer()
+		return storedCredentials(host)
+	}
+	return username, password
+}
+
+// parseFlags separates "--flag value", "--flag=value" and "--flag" arguments
+// from positional ones. flags maps the accepted flag names to whether they
+// take a value; flags without a value are returned set to "true".
+func parseFlags(args []string, flags map[string]bool) (map[string]string, []string, error) {
+	values := map[string]string{}
+	params := []string{}
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "--") {
+			params = append(params, args[i])
+			continue
+		}
+		name := strings.TrimPrefix(args[i], "--")
+		value, hasValue := "", false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		takesValue, ok := flags[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("Error, unknown flag --%s", name)
+		}
+		if takesValue && !hasValue {
+			if i+1 == len(args) {
+				return nil, nil, fmt.Errorf("Error, missing value for --%s", name)
+			}
+			i++
+			value = args[i]
+		} else if !takesValue {
+			if hasValue {
+				return nil, nil, fmt.Errorf("Error, --%s does not take a value", name)
+			}
+			value = "true"
+		}
+		values[name] = value
+	}
+	return values, params, nil
 }
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetJobAndPassword(t *testing.T) {
@@ -58,6 +61,30 @@ func TestGetPriority(t *testing.T) {
 	}
 }
 
+func TestGetTimeout(t *testing.T) {
+	var tests = []struct {
+		env     string
+		value   string
+		timeout time.Duration
+	}{
+		{"kestrel_options", "solver=cplex timeout=30", 30 * time.Second},
+		{"kestrel_options", " timeout = 2.5 ", 2500 * time.Millisecond},
+		{"kestrel_options", "timeout=abc", 0},
+		{"kestrel_options", "", 0},
+	}
+	for i, tt := range tests {
+		testname := fmt.Sprintf("test #%d", i)
+		t.Run(testname, func(t *testing.T) {
+			os.Setenv(tt.env, tt.value)
+			timeout := getTimeout()
+			os.Unsetenv(tt.env)
+			if timeout != tt.timeout {
+				t.Errorf("got '%v', want '%v'", timeout, tt.timeout)
+			}
+		})
+	}
+}
+
 func TestGetNEOSServer(t *testing.T) {
 	var tests = []struct {
 		env   string
@@ -188,11 +215,11 @@ func TestGetSolverName(t *testing.T) {
 			os.Setenv(tt.env1, tt.value1)
 			os.Setenv(tt.env2, tt.value2)
 			os.Setenv(tt.env3, tt.value3)
-			kestrel, err := NewKestrel()
+			kestrel, err := NewKestrel(context.Background())
 			failed := err != nil
 			solver := ""
 			if !failed {
-				solver, err = kestrel.getSolverName()
+				solver, err = kestrel.getSolverName(context.Background())
 				failed = err != nil
 			}
 			unsetEnv(tt.env1, tt.env2, tt.env3)
@@ -205,3 +232,186 @@ func TestGetSolverName(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFlags(t *testing.T) {
+	flags := map[string]bool{"job": true, "all": false}
+	var tests = []struct {
+		args   []string
+		values map[string]string
+		params []string
+		failed bool
+	}{
+		{[]string{"kmodel", "--job", "12"}, map[string]string{"job": "12"}, []string{"kmodel"}, false},
+		{[]string{"--job=12", "kmodel"}, map[string]string{"job": "12"}, []string{"kmodel"}, false},
+		{[]string{"--all"}, map[string]string{"all": "true"}, []string{}, false},
+		{[]string{"--job"}, nil, nil, true},
+		{[]string{"--all=1"}, nil, nil, true},
+		{[]string{"--force"}, nil, nil, true},
+	}
+	for i, tt := range tests {
+		testname := fmt.Sprintf("test #%d", i)
+		t.Run(testname, func(t *testing.T) {
+			values, params, err := parseFlags(tt.args, flags)
+			if failed := err != nil; failed != tt.failed {
+				t.Fatalf("got '%v', want failed=%v", err, tt.failed)
+			}
+			if fmt.Sprint(values) != fmt.Sprint(tt.values) || fmt.Sprint(params) != fmt.Sprint(tt.params) {
+				t.Errorf("got '%v', '%v', want '%v', '%v'", values, params, tt.values, tt.params)
+			}
+		})
+	}
+}
+
+func TestRedactPasswords(t *testing.T) {
+	var tests = []struct {
+		options string
+		setting string
+		redact  bool
+	}{
+		{"solver=cplex", "", false},
+		{"solver=cplex redact=1", "", true},
+		{"redact=true", "", true},
+		{"redact=0", "1", false},
+		{"solver=cplex", "yes", true},
+		{"solver=cplex noredact=1", "", false},
+	}
+	for i, tt := range tests {
+		testname := fmt.Sprintf("test #%d", i)
+		t.Run(testname, func(t *testing.T) {
+			os.Setenv("kestrel_options", tt.options)
+			os.Setenv("kestrel_redact", tt.setting)
+			redact, password := redactPasswords(), redacted("secret")
+			unsetEnv("kestrel_options", "kestrel_redact")
+			want := "secret"
+			if tt.redact {
+				want = redactedPassword
+			}
+			if redact != tt.redact || password != want {
+				t.Errorf("got '%v', '%v', want '%v', '%v'", redact, password, tt.redact, want)
+			}
+		})
+	}
+}
+
+func TestGetJobAndPasswordQueued(t *testing.T) {
+	defer os.Remove(jobsFile())
+	if err := writeJobs([]Job{{Number: 1001, Password: "secret"}}, jobsFile()); err != nil {
+		t.Fatal(err)
+	}
+	defer unsetEnv("kestrel_options")
+	for _, options := range []string{"job=1001", "job=1001 password=********", "job=1001 password=secret"} {
+		os.Setenv("kestrel_options", options)
+		if jobNumber, password := getJobAndPassword(); jobNumber != 1001 || password != "secret" {
+			t.Errorf("got '%v', '%v', want '%v', '%v'", jobNumber, password, 1001, "secret")
+		}
+	}
+	os.Setenv("kestrel_options", "job=1002")
+	if jobNumber, password := getJobAndPassword(); jobNumber != 1002 || password != "" {
+		t.Errorf("got '%v', '%v', want '%v', '%v'", jobNumber, password, 1002, "")
+	}
+}
+
+func TestRedactOptions(t *testing.T) {
+	var tests = []struct {
+		value, want string
+	}{
+		{"solver=cplex", "solver=cplex"},
+		{"job=1234 password=abcd redact", "job=1234 password=******** redact"},
+		{"PASSWORD = 'a b' solver=cplex", "PASSWORD = ******** solver=cplex"},
+		{"job 1234 password abcd", "job 1234 password ********"},
+		{"name=password", "name=password"},
+		{"password='unterminated", "********"},
+	}
+	for _, tt := range tests {
+		if got := redactOptions(tt.value); got != tt.want {
+			t.Errorf("got '%v', want '%v'", got, tt.want)
+		}
+	}
+}
+
+func TestRunConfigShowRedact(t *testing.T) {
+	os.Setenv("kestrel_options", "job=1234 password=abcd redact=1")
+	defer unsetEnv("kestrel_options")
+	var exit int
+	var err error
+	output := captureOutput(t, func() {
+		exit, err = run([]string{"kestrel", "config", "show"})
+	})
+	if exit != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	if strings.Contains(output, "abcd") || !strings.Contains(output, "password="+redactedPassword) {
+		t.Errorf("got '%v', want the job password masked", output)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	var tests = []struct {
+		value    string
+		options  Options
+		warnings int
+		failed   bool
+	}{
+		{"", Options{Priority: "short"}, 0, false},
+		{"solver=cplex priority=long", Options{Solver: "cplex", Priority: "long"}, 0, false},
+		{" SOLVER = Gurobi  Priority = LONG ", Options{Solver: "Gurobi", Priority: "long"}, 0, false},
+		{"solver cplex timeout 2.5", Options{Solver: "cplex", Priority: "short", Timeout: 2500 * time.Millisecond}, 0, false},
+		{"job=1234 password='a b=c' name=\"my job\"", Options{Priority: "short", Job: 1234, Password: "a b=c", Name: "my job"}, 0, false},
+		{"redact solver=cplex", Options{Solver: "cplex", Priority: "short", Redact: "1"}, 0, false},
+		{"outputs=cplex.log,iis.ilp", Options{Priority: "short", Outputs: "cplex.log,iis.ilp"}, 0, false},
+		{"outputs=../cplex.log", Options{Priority: "short"}, 0, true},
+		{"poll=2.5", Options{Priority: "short", Poll: 2500 * time.Millisecond}, 0, false},
+		{"poll=0", Options{Priority: "short"}, 0, true},
+		{"poll=0.01", Options{Priority: "short"}, 0, true},
+		{"priority=long detach", Options{Priority: "long", Detach: true}, 0, false},
+		{"detach=later", Options{Priority: "short"}, 0, true},
+		{"mysolver=cplex", Options{Priority: "short"}, 1, false},
+		{" priorit y = long ", Options{Priority: "short"}, 2, false},
+		{"priority=medium solver=cplex", Options{Solver: "cplex", Priority: "short"}, 0, true},
+		{"timeout=abc", Options{Priority: "short"}, 0, true},
+		{"job=12ab", Options{Priority: "short"}, 0, true},
+		{"redact=maybe", Options{Priority: "short"}, 0, true},
+		{"solver=", Options{Priority: "short"}, 0, true},
+		{"solver", Options{Priority: "short"}, 0, true},
+		{"name='unterminated", Options{Priority: "short"}, 0, true},
+	}
+	for i, tt := range tests {
+		testname := fmt.Sprintf("test #%d", i)
+		t.Run(testname, func(t *testing.T) {
+			options, warnings, err := parseOptions(tt.value)
+			if options != tt.options {
+				t.Errorf("got '%+v', want '%+v'", options, tt.options)
+			}
+			if len(warnings) != tt.warnings {
+				t.Errorf("got '%v', want %d warnings", warnings, tt.warnings)
+			}
+			if failed := err != nil; failed != tt.failed {
+				t.Errorf("got '%v', want failed=%v", err, tt.failed)
+			}
+		})
+	}
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	defer unsetEnv("kestrel_options")
+	os.Setenv("kestrel_options", "solver=cplex priority=medium")
+	exit, err := run([]string{"kestrel", "status"})
+	want := "Error, invalid kestrel_options: priority 'medium' is not short or long."
+	if exit != 1 || err == nil || err.Error() != want {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	exit, err = run([]string{"kestrel", "config", "show"})
+	if exit != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+	os.Setenv("kestrel_options", "solver=cplex poll=0.5")
+	exit, err = run([]string{"kestrel", "status"})
+	want = "Error, invalid kestrel_options: poll '0.5' is not a number of seconds of at least 1."
+	if exit != 1 || err == nil || err.Error() != want {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, want)
+	}
+	exit, err = run([]string{"kestrel", "-v"})
+	if exit != 0 || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", exit, err, 0)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ampl/gokestrel/neos/kestrel"
+)
+
+// solverCacheTTL is how long the cached solver catalog is used without
+// asking NEOS again.
+var solverCacheTTL = 24 * time.Hour
+
+// cacheDir returns the directory kestrel caches files under; tests replace it.
+var cacheDir = os.UserCacheDir
+
+// solverCatalog is the cached list of kestrel:AMPL solvers of a server.
+type solverCatalog struct {
+	Server  string    `json:"server"`
+	Updated time.Time `json:"updated"`
+	Solvers []string  `json:"solvers"`
+}
+
+func solversFile(server string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(server)
+	return filepath.Join(dir, "kestrel", fmt.Sprintf("solvers-%s.json", name)), nil
+}
+
+// readSolverCatalog returns the catalog cached for server, or nil if there
+// is none.
+func readSolverCatalog(server string) (*solverCatalog, error) {
+	fname, err := solversFile(server)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(fname)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	catalog := &solverCatalog{}
+	if err := json.Unmarshal(content, catalog); err != nil || catalog.Server != server {
+		// A corrupt cache is simply reloaded
+		return nil, nil
+	}
+	return catalog, nil
+}
+
+func writeSolverCatalog(catalog *solverCatalog) error {
+	fname, err := solversFile(catalog.Server)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fname), 0700); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(fname, append(content, '\n'), 0644)
+}
+
+// amplSolvers returns the kestrel:AMPL solvers of the server of client, from
+// the cache unless it is older than solverCacheTTL or refresh is set. cached
+// reports whether the list comes from the cache. When NEOS cannot be
+// reached, an outdated cache is used with a warning.
+func amplSolvers(ctx context.Context, client *kestrel.Client, refresh bool) (solvers []string, cached bool, err error) {
+	server := fmt.Sprintf("%s:%s", client.Host, client.Port)
+	catalog, err := readSolverCatalog(server)
+	if err != nil {
+		fmt.Printf("Warning, could not read the solver cache: %v\n", err)
+	}
+	if catalog != nil && !refresh && time.Since(catalog.Updated) < solverCacheTTL {
+		return catalog.Solvers, true, nil
+	}
+	solvers, err = client.AMPLSolvers(ctx)
+	if err != nil {
+		if catalog != nil && ctx.Err() == nil {
+			printStaleCatalog(catalog, err)
+			return catalog.Solvers, true, nil
+		}
+		return nil, false, err
+	}
+	catalog = &solverCatalog{Server: server, Updated: time.Now(), Solvers: solvers}
+	if err := writeSolverCatalog(catalog); err != nil {
+		fmt.Printf("Warning, could not cache the solver list: %v\n", err)
+	}
+	return solvers, false, nil
+}
+
+func printStaleCatalog(catalog *solverCatalog, err error) {
+	fmt.Printf("Warning, could not reach NEOS: %v\n", err)
+	fmt.Printf("Using the solver list cached %s ago.\n", formatAge(time.Since(catalog.Updated)))
+}
+
+// solvers prints the kestrel:AMPL solvers available on the server.
+func solvers(ctx context.Context, refresh bool) (int, error) {
+	var list []string
+	client, err := connect(ctx)
+	if err == nil {
+		list, _, err = amplSolvers(ctx, client, refresh)
+	} else if errors.Is(err, kestrel.ErrUnavailable) {
+		host, port := getNEOSServer()
+		catalog, cerr := readSolverCatalog(fmt.Sprintf("%s:%s", host, port))
+		if cerr != nil || catalog == nil {
+			return 1, err
+		}
+		printStaleCatalog(catalog, err)
+		list, err = catalog.Solvers, nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	fmt.Println("Solvers available on NEOS for AMPL models:")
+	for _, s := range list {
+		fmt.Printf("\t%s\n", s)
+	}
+	return 0, nil
+}
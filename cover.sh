@@ -1,3 +1,3 @@
 #!/bin/bash
-go test -v -coverprofile cover.out ./cmd/gokestrel
+go test -v -coverprofile cover.out ./...
 go tool cover -html=cover.out -o cover.html
@@ -0,0 +1,64 @@
+package kestrel
+
+import (
+	"fmt"
+	"strings"
+
+	"ampl/gokestrel/amplfile"
+)
+
+// Capabilities describes the problems a solver handles.
+type Capabilities struct {
+	Integer   bool // integer and binary variables
+	Quadratic bool // quadratic objectives and constraints
+	Nonlinear bool // general nonlinear expressions
+}
+
+// SolverCapabilities lists what the kestrel:AMPL solvers on NEOS handle,
+// keyed by lower case solver name. Solvers missing from the list are not
+// checked.
+var SolverCapabilities = map[string]Capabilities{
+	"baron":       {Integer: true, Quadratic: true, Nonlinear: true},
+	"bonmin":      {Integer: true, Quadratic: true, Nonlinear: true},
+	"cbc":         {Integer: true},
+	"clp":         {},
+	"conopt":      {Quadratic: true, Nonlinear: true},
+	"couenne":     {Integer: true, Quadratic: true, Nonlinear: true},
+	"cplex":       {Integer: true, Quadratic: true},
+	"filter":      {Quadratic: true, Nonlinear: true},
+	"fico-xpress": {Integer: true, Quadratic: true},
+	"gurobi":      {Integer: true, Quadratic: true},
+	"highs":       {Integer: true, Quadratic: true},
+	"ipopt":       {Quadratic: true, Nonlinear: true},
+	"knitro":      {Integer: true, Quadratic: true, Nonlinear: true},
+	"lancelot":    {Quadratic: true, Nonlinear: true},
+	"loqo":        {Quadratic: true, Nonlinear: true},
+	"minos":       {Quadratic: true, Nonlinear: true},
+	"mosek":       {Integer: true, Quadratic: true},
+	"octeract":    {Integer: true, Quadratic: true, Nonlinear: true},
+	"scip":        {Integer: true, Quadratic: true, Nonlinear: true},
+	"snopt":       {Quadratic: true, Nonlinear: true},
+}
+
+// ModelWarnings returns the reasons why solver is a poor match for the
+// problem described by h, if any.
+func ModelWarnings(solver string, h *amplfile.Header) []string {
+	capabilities, ok := SolverCapabilities[strings.ToLower(solver)]
+	if !ok {
+		return nil
+	}
+	var warnings []string
+	// The header does not tell quadratic terms from other nonlinear ones, so
+	// only solvers handling neither are warned about
+	if h.Nonlinear() && !capabilities.Nonlinear && !capabilities.Quadratic {
+		warnings = append(warnings, fmt.Sprintf(
+			"%s is a linear solver but the problem has %d nonlinear constraints and %d nonlinear objectives",
+			solver, h.NonlinearConstraints, h.NonlinearObjectives))
+	}
+	if h.Discrete() > 0 && !capabilities.Integer {
+		warnings = append(warnings, fmt.Sprintf(
+			"%s does not handle integer variables, the %d integer variables of the problem will be relaxed",
+			solver, h.Discrete()))
+	}
+	return warnings
+}
@@ -0,0 +1,41 @@
+package kestrel
+
+import (
+	"strings"
+	"testing"
+
+	"ampl/gokestrel/amplfile"
+)
+
+func TestModelWarnings(t *testing.T) {
+	lp := &amplfile.Header{Variables: 2, Constraints: 1, Objectives: 1}
+	nlp := &amplfile.Header{Variables: 2, Constraints: 1, Objectives: 1, NonlinearConstraints: 1}
+	milp := &amplfile.Header{Variables: 2, Constraints: 1, Objectives: 1, IntegerVariables: 2}
+	var tests = []struct {
+		solver string
+		header *amplfile.Header
+		want   []string
+	}{
+		{"CPLEX", lp, nil},
+		{"CPLEX", milp, nil},
+		{"Ipopt", nlp, nil},
+		{"Unknown", nlp, nil},
+		{"Clp", nlp, []string{"Clp is a linear solver"}},
+		{"Gurobi", nlp, nil}, // may well be a QP
+		{"Ipopt", milp, []string{"Ipopt does not handle integer variables"}},
+		{"clp", &amplfile.Header{NonlinearObjectives: 1, BinaryVariables: 1},
+			[]string{"clp is a linear solver", "clp does not handle integer variables"}},
+	}
+	for _, tt := range tests {
+		got := ModelWarnings(tt.solver, tt.header)
+		if len(got) != len(tt.want) {
+			t.Errorf("got '%v', want '%v'", got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !strings.HasPrefix(got[i], tt.want[i]) {
+				t.Errorf("got '%v', want '%v'", got, tt.want)
+			}
+		}
+	}
+}
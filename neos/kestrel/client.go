@@ -0,0 +1,541 @@
+// Package kestrel is a client for the NEOS Server XML-RPC interface as used
+// by the kestrel AMPL solver driver. See https://neos-server.org/neos/xml-rpc.html.
+package kestrel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"alexejk.io/go-xmlrpc"
+)
+
+// DefaultHost and DefaultPort locate the public NEOS server.
+const (
+	DefaultHost = "neos-server.org"
+	DefaultPort = "3333"
+)
+
+// DefaultConnectTimeout bounds the time spent establishing a connection when
+// Config.ConnectTimeout is not set.
+const DefaultConnectTimeout = 30 * time.Second
+
+// ErrUnavailable is returned by NewClient when the server does not answer.
+var ErrUnavailable = errors.New("NEOS solver is temporarily unavailable")
+
+// Config holds the settings used to connect to NEOS.
+type Config struct {
+	Host, Port             string
+	Username, UserPassword string        // used for authenticated submissions when both are set
+	User                   string        // free-form user description sent with anonymous submissions
+	HTTPClient             *http.Client  // optional, defaults to a client honouring ConnectTimeout
+	ConnectTimeout         time.Duration // bound on dialing the server, DefaultConnectTimeout if zero
+	Timeout                time.Duration // bound on every call including reading the response, except blocking ones and the upload of Submit, none if zero
+	Retry                  RetryPolicy   // applied to calls that are safe to repeat, DefaultRetryPolicy if zero
+}
+
+// Client talks to a NEOS server.
+type Client struct {
+	Host, Port             string
+	Username, UserPassword string
+	User                   string
+	Retry                  RetryPolicy
+	endpoint               string
+	rpcHTTP                *http.Client
+	blockingHTTP           *http.Client // for blockingMethods, without Config.Timeout
+	http                   *http.Client // for Submit, where Config.Timeout only bounds the wait for the response
+}
+
+// Job identifies a NEOS job.
+type Job struct {
+	Number   int
+	Password string
+}
+
+// Status is a job status as reported by getJobStatus.
+type Status string
+
+const (
+	StatusWaiting     Status = "Waiting"
+	StatusRunning     Status = "Running"
+	StatusDone        Status = "Done"
+	StatusUnknownJob  Status = "Unknown Job"
+	StatusBadPassword Status = "Bad Password"
+)
+
+// Active reports whether the job is still queued or running.
+func (s Status) Active() bool {
+	return s == StatusWaiting || s == StatusRunning
+}
+
+// CompletionCode tells how a finished job ended, as reported by
+// getCompletionCode.
+type CompletionCode string
+
+const (
+	CompletionNormal       CompletionCode = "Normal"
+	CompletionOutOfMemory  CompletionCode = "Out of memory"
+	CompletionTimedOut     CompletionCode = "Timed out"
+	CompletionDisconnected CompletionCode = "Disconnected"
+	CompletionSystemError  CompletionCode = "System error"
+)
+
+// JobInfo describes a job as reported by getJobInfo.
+type JobInfo struct {
+	Category, Solver, Input string
+	Status                  Status
+}
+
+// Output is a chunk of intermediate job output.
+type Output struct {
+	Text   string
+	Offset int // offset to pass to the next IntermediateResults call
+}
+
+// SubmitError is returned when NEOS rejects a submission.
+type SubmitError struct {
+	Message string
+}
+
+func (e *SubmitError) Error() string {
+	return fmt.Sprintf("Error: %s\nJob not submitted.\n", e.Message)
+}
+
+// SolverError is returned when the requested solver is missing or not
+// offered by NEOS. Available lists the solvers that can be chosen instead.
+type SolverError struct {
+	Solver    string
+	Available []string
+}
+
+func (e *SolverError) Error() string {
+	if e.Solver == "" {
+		return "No solver name selected."
+	}
+	return fmt.Sprintf("%s is not available on NEOS.", e.Solver)
+}
+
+// NewClient connects to the NEOS server described by cfg and pings it.
+func NewClient(ctx context.Context, cfg Config) (*Client, error) {
+	if cfg.Host == "" {
+		cfg.Host = DefaultHost
+	}
+	if cfg.Port == "" {
+		cfg.Port = DefaultPort
+	}
+	endpoint := fmt.Sprintf("https://%s:%s", cfg.Host, cfg.Port)
+	blockingCfg := cfg
+	blockingCfg.Timeout = 0
+	c := &Client{
+		Host:         cfg.Host,
+		Port:         cfg.Port,
+		Username:     cfg.Username,
+		UserPassword: cfg.UserPassword,
+		User:         cfg.User,
+		Retry:        cfg.Retry,
+		endpoint:     endpoint,
+		rpcHTTP:      newHTTPClient(cfg),
+		blockingHTTP: newHTTPClient(blockingCfg),
+		http:         newUploadHTTPClient(cfg),
+	}
+	if c.Retry.MaxAttempts == 0 {
+		c.Retry = DefaultRetryPolicy
+	}
+	if err := c.Ping(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return c, nil
+}
+
+func newHTTPClient(cfg Config) *http.Client {
+	client := http.Client{}
+	if cfg.HTTPClient != nil {
+		client = *cfg.HTTPClient
+	} else {
+		connectTimeout := cfg.ConnectTimeout
+		if connectTimeout == 0 {
+			connectTimeout = DefaultConnectTimeout
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = (&net.Dialer{Timeout: connectTimeout}).DialContext
+		transport.TLSHandshakeTimeout = connectTimeout
+		client.Transport = transport
+	}
+	if cfg.Timeout != 0 {
+		client.Timeout = cfg.Timeout
+	}
+	return &client
+}
+
+// newUploadHTTPClient returns the client used by Submit. Sending a large
+// model can take longer than cfg.Timeout, so the timeout only bounds the
+// wait for the response headers once the request is sent.
+func newUploadHTTPClient(cfg Config) *http.Client {
+	uploadCfg := cfg
+	uploadCfg.Timeout = 0
+	client := newHTTPClient(uploadCfg)
+	if cfg.Timeout == 0 {
+		return client
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if client.Transport == nil {
+		transport, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if ok {
+		transport = transport.Clone()
+		transport.ResponseHeaderTimeout = cfg.Timeout
+		client.Transport = transport
+	}
+	return client
+}
+
+// blockingMethods wait on NEOS until the job produces output or finishes,
+// which can take hours, so Config.Timeout does not apply to them.
+var blockingMethods = map[string]bool{
+	"getFinalResults":        true,
+	"getIntermediateResults": true,
+}
+
+// call invokes method and waits for the response. Cancelling ctx aborts the
+// underlying HTTP request.
+func (c *Client) call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	httpClient := *c.rpcHTTP
+	if blockingMethods[method] {
+		httpClient = *c.blockingHTTP
+	}
+	httpClient.Transport = contextTransport{ctx: ctx, base: httpClient.Transport}
+	// The XML-RPC client has no context of its own, so one is made for every
+	// call to send the request with ctx
+	rpc, err := xmlrpc.NewClient(c.endpoint, xmlrpc.HttpClient(&httpClient))
+	if err != nil {
+		return err
+	}
+	defer rpc.Close()
+	err = rpc.Call(method, args, reply)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// contextTransport sends requests with ctx, so that cancelling ctx aborts
+// them.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(r.WithContext(t.ctx))
+}
+
+// retryCall is call for methods that can safely be repeated, retried
+// according to c.Retry while the failure is transient.
+func (c *Client) retryCall(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	return c.Retry.Do(ctx, func() error {
+		return c.call(ctx, method, args, reply)
+	})
+}
+
+// Ping checks that the server is alive.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, "ping", nil, nil)
+}
+
+// Authenticated reports whether submissions use authenticatedSubmitJob.
+func (c *Client) Authenticated() bool {
+	return c.Username != "" && c.UserPassword != ""
+}
+
+// ResultsURL returns the web page where the progress of job can be followed.
+func (c *Client) ResultsURL(job Job) string {
+	return fmt.Sprintf("https://%s/neos/cgi-bin/nph-neos-solver.cgi?admin=results&jobnumber=%d&pass=%s",
+		c.Host, job.Number, job.Password)
+}
+
+// SubmitJob submits an XML job document, see Submission.
+func (c *Client) SubmitJob(ctx context.Context, document string) (Job, error) {
+	result := struct {
+		Results []interface{}
+	}{}
+	if !c.Authenticated() {
+		request := struct {
+			Xml     string
+			User    string
+			Kestrel string
+		}{document, c.User, "kestrel"}
+		if err := c.call(ctx, "submitJob", &request, &result); err != nil {
+			return Job{}, err
+		}
+	} else {
+		request := struct {
+			Xml      string
+			Username string
+			Password string
+			Kestrel  string
+		}{document, c.Username, c.UserPassword, "kestrel"}
+		if err := c.call(ctx, "authenticatedSubmitJob", &request, &result); err != nil {
+			return Job{}, err
+		}
+	}
+	return submitted(result.Results)
+}
+
+// submitted interprets the [job number, password] pair returned by the submit
+// methods, where a zero job number comes with an error message instead.
+func submitted(results []interface{}) (Job, error) {
+	job := Job{}
+	if len(results) != 2 {
+		return job, &SubmitError{fmt.Sprintf("unexpected response %v", results)}
+	}
+	if v, ok := results[0].(int); ok {
+		job.Number = v
+	}
+	if job.Number == 0 {
+		return job, &SubmitError{fmt.Sprint(results[1])}
+	}
+	if v, ok := results[1].(string); ok {
+		job.Password = v
+	}
+	return job, nil
+}
+
+// JobStatus returns the current status of job.
+func (c *Client) JobStatus(ctx context.Context, job Job) (Status, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+	}{job.Number, job.Password}
+	result := struct {
+		Status string
+	}{}
+	if err := c.retryCall(ctx, "getJobStatus", &request, &result); err != nil {
+		return "", err
+	}
+	return Status(result.Status), nil
+}
+
+// IntermediateResults returns the output produced by job since offset. NEOS
+// blocks the call until new output is available or the job ends.
+func (c *Client) IntermediateResults(ctx context.Context, job Job, offset int) (Output, error) {
+	return c.intermediateResults(ctx, "getIntermediateResults", job, offset)
+}
+
+// IntermediateResultsNonBlocking is IntermediateResults without waiting for
+// new output, the text is empty when there is none.
+func (c *Client) IntermediateResultsNonBlocking(ctx context.Context, job Job, offset int) (Output, error) {
+	return c.intermediateResults(ctx, "getIntermediateResultsNonBlocking", job, offset)
+}
+
+func (c *Client) intermediateResults(ctx context.Context, method string, job Job, offset int) (Output, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+		Offset    int
+	}{job.Number, job.Password, offset}
+	result := struct {
+		Results []interface{}
+	}{}
+	if err := c.retryCall(ctx, method, &request, &result); err != nil {
+		return Output{}, err
+	}
+	output := Output{Offset: offset}
+	if len(result.Results) == 2 {
+		output.Text = text(result.Results[0])
+		if v, ok := result.Results[1].(int); ok {
+			output.Offset = v
+		}
+	}
+	return output, nil
+}
+
+// FinalResults waits for job to finish and returns its results, which for
+// kestrel jobs is the AMPL solution file.
+func (c *Client) FinalResults(ctx context.Context, job Job) (string, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+	}{job.Number, job.Password}
+	result := struct {
+		Solution interface{}
+	}{}
+	if err := c.retryCall(ctx, "getFinalResults", &request, &result); err != nil {
+		return "", err
+	}
+	return text(result.Solution), nil
+}
+
+// FinalResultsNonBlocking returns the results of job without waiting, empty
+// if the job has not finished.
+func (c *Client) FinalResultsNonBlocking(ctx context.Context, job Job) (string, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+	}{job.Number, job.Password}
+	result := struct {
+		Solution interface{}
+	}{}
+	if err := c.retryCall(ctx, "getFinalResultsNonBlocking", &request, &result); err != nil {
+		return "", err
+	}
+	return text(result.Solution), nil
+}
+
+// CompletionCode returns how job ended. It is only meaningful once the job
+// is done.
+func (c *Client) CompletionCode(ctx context.Context, job Job) (CompletionCode, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+	}{job.Number, job.Password}
+	result := struct {
+		Code string
+	}{}
+	if err := c.retryCall(ctx, "getCompletionCode", &request, &result); err != nil {
+		return "", err
+	}
+	return CompletionCode(result.Code), nil
+}
+
+// JobInfo returns the category, solver, input method and status of job.
+func (c *Client) JobInfo(ctx context.Context, job Job) (JobInfo, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+	}{job.Number, job.Password}
+	result := struct {
+		Results []interface{}
+	}{}
+	if err := c.retryCall(ctx, "getJobInfo", &request, &result); err != nil {
+		return JobInfo{}, err
+	}
+	if len(result.Results) != 4 {
+		return JobInfo{}, fmt.Errorf("unexpected getJobInfo response %v", result.Results)
+	}
+	return JobInfo{
+		Category: fmt.Sprint(result.Results[0]),
+		Solver:   fmt.Sprint(result.Results[1]),
+		Input:    fmt.Sprint(result.Results[2]),
+		Status:   Status(fmt.Sprint(result.Results[3])),
+	}, nil
+}
+
+// OutputFile returns the content of a file written by job on NEOS besides
+// its results, such as a solver log.
+func (c *Client) OutputFile(ctx context.Context, job Job, name string) ([]byte, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+		FileName  string
+	}{job.Number, job.Password, name}
+	result := struct {
+		File interface{}
+	}{}
+	if err := c.retryCall(ctx, "getOutputFile", &request, &result); err != nil {
+		return nil, err
+	}
+	return []byte(text(result.File)), nil
+}
+
+// KillJob kills job and returns the server response.
+func (c *Client) KillJob(ctx context.Context, job Job) (string, error) {
+	request := struct {
+		JobNumber int
+		Password  string
+	}{job.Number, job.Password}
+	result := struct {
+		Response string
+	}{}
+	if err := c.retryCall(ctx, "killJob", &request, &result); err != nil {
+		return "", err
+	}
+	return result.Response, nil
+}
+
+// Queue returns the NEOS job queue as printed by printQueue.
+func (c *Client) Queue(ctx context.Context) (string, error) {
+	result := struct {
+		Queue string
+	}{}
+	if err := c.retryCall(ctx, "printQueue", nil, &result); err != nil {
+		return "", err
+	}
+	return result.Queue, nil
+}
+
+// ListSolvers returns the solvers available in category as "name:input" pairs.
+func (c *Client) ListSolvers(ctx context.Context, category string) ([]string, error) {
+	request := struct {
+		Category string
+	}{category}
+	result := struct {
+		Solvers []string
+	}{}
+	if err := c.retryCall(ctx, "listSolversInCategory", &request, &result); err != nil {
+		return nil, err
+	}
+	return result.Solvers, nil
+}
+
+// AMPLSolvers returns the names of the kestrel solvers accepting AMPL input.
+func (c *Client) AMPLSolvers(ctx context.Context) ([]string, error) {
+	all, err := c.ListSolvers(ctx, "kestrel")
+	if err != nil {
+		return nil, err
+	}
+	solvers := []string{}
+	for _, s := range all {
+		if strings.HasSuffix(s, ":AMPL") {
+			solvers = append(solvers, strings.TrimSuffix(s, ":AMPL"))
+		}
+	}
+	return solvers, nil
+}
+
+// ResolveSolver maps name to the spelling used by NEOS. The comparison is
+// case insensitive, but NEOS is not.
+func (c *Client) ResolveSolver(ctx context.Context, name string) (string, error) {
+	solvers, err := c.AMPLSolvers(ctx)
+	if err != nil {
+		return "", err
+	}
+	return MatchSolver(solvers, name)
+}
+
+// MatchSolver is ResolveSolver for a list of solvers obtained earlier from
+// AMPLSolvers.
+func MatchSolver(solvers []string, name string) (string, error) {
+	if name != "" {
+		for _, s := range solvers {
+			if strings.EqualFold(s, name) {
+				return s, nil
+			}
+		}
+	}
+	return "", &SolverError{Solver: name, Available: solvers}
+}
+
+// text converts base64 results, decoded as []byte, and plain strings to string.
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return ""
+}
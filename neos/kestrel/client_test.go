@@ -0,0 +1,275 @@
+package kestrel
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ampl/gokestrel/neos/neostest"
+)
+
+func newTestClient(t *testing.T) (*neostest.Server, *Client) {
+	t.Helper()
+	ctx := context.Background()
+	srv := neostest.NewServer()
+	t.Cleanup(srv.Close)
+	c, err := NewClient(ctx, Config{Host: srv.Host, Port: srv.Port, HTTPClient: srv.Client()})
+	if err != nil {
+		t.Fatalf("NewClient failed with '%v'", err)
+	}
+	return srv, c
+}
+
+func newTestSubmission(t *testing.T) *Submission {
+	t.Helper()
+	stub := filepath.Join(t.TempDir(), "model")
+	if err := ioutil.WriteFile(stub+".nl", []byte("g3 1 1 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &Submission{Stub: stub, Solver: "CPLEX", Email: "test@test.com", Priority: "short"}
+}
+
+func TestNewClientUnavailable(t *testing.T) {
+	ctx := context.Background()
+	srv := neostest.NewServer()
+	srv.Close()
+	_, err := NewClient(ctx, Config{Host: srv.Host, Port: srv.Port, HTTPClient: srv.Client()})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("got '%v', want '%v'", err, ErrUnavailable)
+	}
+}
+
+func TestSubmitJobLifecycle(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	document, err := newTestSubmission(t).XML()
+	if err != nil {
+		t.Fatalf("XML failed with '%v'", err)
+	}
+	job, err := c.SubmitJob(ctx, document)
+	if err != nil {
+		t.Fatalf("SubmitJob failed with '%v'", err)
+	}
+	if srv.Job(job.Number) == nil {
+		t.Fatalf("job %d not found on server", job.Number)
+	}
+	output, status := "", Status("")
+	offset := 0
+	for i := 0; i < 10; i++ {
+		status, err = c.JobStatus(ctx, job)
+		if err != nil {
+			t.Fatalf("JobStatus failed with '%v'", err)
+		}
+		chunk, err := c.IntermediateResults(ctx, job, offset)
+		if err != nil {
+			t.Fatalf("IntermediateResults failed with '%v'", err)
+		}
+		output += chunk.Text
+		offset = chunk.Offset
+		if !status.Active() {
+			break
+		}
+	}
+	if status != StatusDone {
+		t.Errorf("got '%v', want '%v'", status, StatusDone)
+	}
+	want := ""
+	for _, step := range neostest.DefaultLifecycle.Steps {
+		want += step.Output
+	}
+	if output != want {
+		t.Errorf("got '%v', want '%v'", output, want)
+	}
+	solution, err := c.FinalResults(ctx, job)
+	if want := neostest.DefaultLifecycle.Solution; solution != want || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", solution, err, want)
+	}
+	response, err := c.KillJob(ctx, job)
+	if err != nil || !strings.Contains(response, "finished") {
+		t.Errorf("got '%v', '%v'", response, err)
+	}
+}
+
+func TestJobStatusBadPassword(t *testing.T) {
+	ctx := context.Background()
+	_, c := newTestClient(t)
+	status, err := c.JobStatus(ctx, Job{Number: 1, Password: "x"})
+	if status != StatusUnknownJob || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", status, err, StatusUnknownJob)
+	}
+	document, _ := newTestSubmission(t).XML()
+	job, _ := c.SubmitJob(ctx, document)
+	job.Password = "wrong"
+	status, err = c.JobStatus(ctx, job)
+	if status != StatusBadPassword || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", status, err, StatusBadPassword)
+	}
+}
+
+func TestJobInfoCompletionCode(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps:          []neostest.Step{{Status: "Running"}, {Status: "Done"}},
+		Solution:       "solution",
+		CompletionCode: "Out of memory",
+	}
+	document, _ := newTestSubmission(t).XML()
+	job, err := c.SubmitJob(ctx, document)
+	if err != nil {
+		t.Fatalf("SubmitJob failed with '%v'", err)
+	}
+	info, err := c.JobInfo(ctx, job)
+	want := JobInfo{Category: "kestrel", Solver: "CPLEX", Input: "AMPL", Status: StatusRunning}
+	if info != want || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", info, err, want)
+	}
+	// Results and completion code are empty until the job is done
+	solution, err := c.FinalResultsNonBlocking(ctx, job)
+	if solution != "" || err != nil {
+		t.Errorf("got '%v', '%v', want ''", solution, err)
+	}
+	code, err := c.CompletionCode(ctx, job)
+	if code != "" || err != nil {
+		t.Errorf("got '%v', '%v', want ''", code, err)
+	}
+	if _, err := c.JobStatus(ctx, job); err != nil {
+		t.Fatalf("JobStatus failed with '%v'", err)
+	}
+	solution, err = c.FinalResultsNonBlocking(ctx, job)
+	if solution != "solution" || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", solution, err, "solution")
+	}
+	code, err = c.CompletionCode(ctx, job)
+	if code != CompletionOutOfMemory || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", code, err, CompletionOutOfMemory)
+	}
+	info, err = c.JobInfo(ctx, Job{Number: job.Number, Password: "wrong"})
+	if info.Status != StatusBadPassword || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", info, err, StatusBadPassword)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	srv.Lifecycle = neostest.Lifecycle{
+		Steps:    []neostest.Step{{Status: "Done"}},
+		Solution: "solution",
+		Files:    map[string]string{"cplex.log": "log"},
+	}
+	document, _ := newTestSubmission(t).XML()
+	job, err := c.SubmitJob(ctx, document)
+	if err != nil {
+		t.Fatalf("SubmitJob failed with '%v'", err)
+	}
+	content, err := c.OutputFile(ctx, job, "cplex.log")
+	if string(content) != "log" || err != nil {
+		t.Errorf("got '%s', '%v', want '%v'", content, err, "log")
+	}
+	if _, err := c.OutputFile(ctx, job, "missing.log"); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestAuthenticatedSubmitJob(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	srv.Users["user"] = "secret"
+	document, _ := newTestSubmission(t).XML()
+	c.Username, c.UserPassword = "user", "secret"
+	job, err := c.SubmitJob(ctx, document)
+	if err != nil {
+		t.Fatalf("SubmitJob failed with '%v'", err)
+	}
+	if got := srv.Job(job.Number).User; got != "user" {
+		t.Errorf("got '%v', want 'user'", got)
+	}
+	c.UserPassword = "wrong"
+	var submitErr *SubmitError
+	if _, err := c.SubmitJob(ctx, document); !errors.As(err, &submitErr) {
+		t.Errorf("got '%v', want a SubmitError", err)
+	}
+}
+
+func TestResolveSolver(t *testing.T) {
+	ctx := context.Background()
+	_, c := newTestClient(t)
+	var tests = []struct {
+		name   string
+		solver string
+		failed bool
+	}{
+		{"cplex", "CPLEX", false},
+		{"GUROBI", "Gurobi", false},
+		{"gams", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solver, err := c.ResolveSolver(ctx, tt.name)
+			var solverErr *SolverError
+			if solver != tt.solver || errors.As(err, &solverErr) != tt.failed {
+				t.Errorf("got '%v', '%v', want '%v'", solver, err, tt.solver)
+			}
+			if tt.failed && len(solverErr.Available) != 3 {
+				t.Errorf("got %v available solvers, want 3", solverErr.Available)
+			}
+		})
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	ctx := context.Background()
+	srv := neostest.NewServer()
+	defer srv.Close()
+	c, err := NewClient(ctx, Config{
+		Host:       srv.Host,
+		Port:       srv.Port,
+		HTTPClient: srv.Client(),
+		Timeout:    50 * time.Millisecond,
+		Retry:      RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewClient failed with '%v'", err)
+	}
+	srv.SetDelay(time.Second)
+	start := time.Now()
+	if _, err := c.JobStatus(ctx, Job{Number: 1}); err == nil {
+		t.Errorf("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("call took %v", elapsed)
+	}
+	// Calls waiting for the job are not bound by the timeout
+	srv.SetDelay(100 * time.Millisecond)
+	if _, err := c.FinalResults(ctx, Job{Number: 1}); err != nil {
+		t.Errorf("got '%v', want no timeout for getFinalResults", err)
+	}
+}
+
+func TestCallCancel(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.SetDelay(200 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := c.JobStatus(ctx, Job{Number: 1}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got '%v', want '%v'", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("call took %v", elapsed)
+	}
+	// The request is aborted rather than left running
+	time.Sleep(300 * time.Millisecond)
+	if n := srv.Calls("getJobStatus"); n != 0 {
+		t.Errorf("got %d calls answered, want 0", n)
+	}
+}
@@ -0,0 +1,231 @@
+package kestrel
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// AuxFileSuffixes lists the AMPL auxiliary files sent along with the .nl file
+// when they exist and are not empty.
+var AuxFileSuffixes = []string{"adj", "col", "env", "fix", "spc", "row", "slc", "unv"}
+
+// AuxOptionNames lists the AMPL options forwarded to NEOS when set.
+var AuxOptionNames = []string{"kestrel_auxfiles", "mip_priorities", "objective_precision"}
+
+// Submission describes a kestrel job.
+type Submission struct {
+	Stub          string // path of the model without the .nl suffix
+	Solver        string // NEOS solver name, see Client.ResolveSolver
+	Email         string
+	Priority      string // "short", "long" or empty for the server default
+	SolverOptions string // value of the <solver>_options AMPL option
+	AuxOptions    map[string]string
+}
+
+// Document is the XML job document of a kestrel submission.
+type Document struct {
+	Category      string
+	Solver        string
+	InputType     string
+	Email         string
+	Priority      string // omitted when empty
+	SolverOptions string
+	NLFile        string    // path of the .nl file, compressed and encoded as it is marshalled
+	Extras        []Element // auxiliary files and options
+}
+
+// Element is an extra document element holding free-form text.
+type Element struct {
+	Name  string
+	Value string
+}
+
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+// textWriter writes everything written to it as escaped character data of e.
+// A trailing incomplete UTF-8 sequence is held back until the rest of it is
+// written, so that text may be split anywhere.
+type textWriter struct {
+	e       *xml.Encoder
+	pending []byte
+}
+
+func (w *textWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(w.pending) != 0 {
+		p = append(w.pending, p...)
+		w.pending = nil
+	}
+	end := len(p)
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	if err := w.e.EncodeToken(xml.CharData(p[:end])); err != nil {
+		return 0, err
+	}
+	w.pending = append([]byte(nil), p[end:]...)
+	return n, nil
+}
+
+// Close writes out any held back bytes.
+func (w *textWriter) Close() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	err := w.e.EncodeToken(xml.CharData(w.pending))
+	w.pending = nil
+	return err
+}
+
+// encodeNLFile writes the gzip-compressed, base64-encoded content of the file
+// at path as character data of e, a block at a time.
+func encodeNLFile(e *xml.Encoder, path string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	encoder := base64.NewEncoder(base64.StdEncoding, &textWriter{e: e})
+	destination := gzip.NewWriter(encoder)
+	if _, err := io.Copy(destination, source); err != nil {
+		return err
+	}
+	if err := destination.Close(); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// MarshalXML encodes d with one element per line. Free-form text that may
+// span lines is written as CDATA, everything else is escaped character data.
+// The .nl file is streamed, so d can be encoded without holding the model in
+// memory when e writes to a file or a network connection.
+func (d *Document) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	newline := xml.CharData("\n")
+	element := func(name string) xml.StartElement {
+		return xml.StartElement{Name: xml.Name{Local: name}}
+	}
+	start = element("document")
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	encode := func(name string, v interface{}) error {
+		if err := e.EncodeToken(newline); err != nil {
+			return err
+		}
+		return e.EncodeElement(v, element(name))
+	}
+	type field struct {
+		name  string
+		value interface{}
+	}
+	fields := []field{
+		{"category", d.Category},
+		{"solver", d.Solver},
+		{"inputType", d.InputType},
+		{"email", d.Email},
+	}
+	if d.Priority != "" {
+		fields = append(fields, field{"priority", d.Priority})
+	}
+	fields = append(fields, field{"solver_options", cdata{d.SolverOptions}})
+	for _, field := range fields {
+		if err := encode(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeToken(newline); err != nil {
+		return err
+	}
+	for _, name := range []string{"nlfile", "base64"} {
+		if err := e.EncodeToken(element(name)); err != nil {
+			return err
+		}
+	}
+	if d.NLFile != "" {
+		if err := encodeNLFile(e, d.NLFile); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"base64", "nlfile"} {
+		if err := e.EncodeToken(element(name).End()); err != nil {
+			return err
+		}
+	}
+	for _, extra := range d.Extras {
+		if err := encode(extra.Name, cdata{extra.Value}); err != nil {
+			return err
+		}
+	}
+	if err := e.EncodeToken(newline); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// Document reads the auxiliary files of s and returns its job document. The
+// .nl file itself is read when the document is encoded.
+func (s *Submission) Document() (*Document, error) {
+	stub := strings.TrimSuffix(s.Stub, ".nl")
+
+	solverOptions := fmt.Sprintf("kestrel_options:solver=%s\n", strings.ToLower(s.Solver))
+	if s.SolverOptions != "" {
+		solverOptions += fmt.Sprintf("%s_options:%s\n", strings.ToLower(s.Solver), s.SolverOptions)
+	}
+
+	// The .nl file is only read when the document is encoded
+	if _, err := os.Stat(stub + ".nl"); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		Category:      "kestrel",
+		Solver:        s.Solver,
+		InputType:     "AMPL",
+		Email:         s.Email,
+		Priority:      s.Priority,
+		SolverOptions: solverOptions,
+		NLFile:        stub + ".nl",
+	}
+
+	for _, key := range AuxFileSuffixes {
+		if content, err := ioutil.ReadFile(stub + "." + key); err == nil && len(content) != 0 {
+			doc.Extras = append(doc.Extras, Element{key, string(content)})
+		}
+	}
+
+	for _, option := range AuxOptionNames {
+		if v, ok := s.AuxOptions[option]; ok {
+			doc.Extras = append(doc.Extras, Element{option, v})
+		}
+	}
+	return doc, nil
+}
+
+// XML returns the job document for s as expected by SubmitJob. Client.Submit
+// streams the document instead and should be preferred for large models.
+func (s *Submission) XML() (string, error) {
+	doc, err := s.Document()
+	if err != nil {
+		return "", err
+	}
+	content, err := xml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,157 @@
+package kestrel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/xml"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+var base64Rgx = regexp.MustCompile(`<base64>[^<]*</base64>`)
+
+func gunzipBase64(s string) ([]byte, error) {
+	compressed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestDocumentGolden(t *testing.T) {
+	var tests = []struct {
+		name       string
+		submission Submission
+		files      map[string]string
+	}{
+		{
+			"basic",
+			Submission{Solver: "CPLEX", Email: "test@test.com", Priority: "short"},
+			nil,
+		},
+		{
+			"no_priority",
+			Submission{Solver: "Ipopt", Email: "test@test.com", SolverOptions: "max_iter=100"},
+			nil,
+		},
+		{
+			"escaping",
+			Submission{
+				Solver:        "CPLEX",
+				Email:         "a&b <test@test.com>",
+				Priority:      "long",
+				SolverOptions: `logfile="C:\a&b<c>.log" mipgap>0 ]]> done`,
+				AuxOptions: map[string]string{
+					"objective_precision": "0",
+					"kestrel_auxfiles":    "rc & <x>",
+				},
+			},
+			map[string]string{
+				"adj": "3 <x> & y\n]]>\n",
+				"col": "x[1]\nx[2]\n",
+				"row": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := filepath.Join(t.TempDir(), "model")
+			nl := []byte("g3 1 1 0\t# problem model\n")
+			if err := ioutil.WriteFile(stub+".nl", nl, 0644); err != nil {
+				t.Fatal(err)
+			}
+			for suffix, content := range tt.files {
+				if err := ioutil.WriteFile(stub+"."+suffix, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.submission.Stub = stub
+			doc, err := tt.submission.Document()
+			if err != nil {
+				t.Fatalf("Document failed with '%v'", err)
+			}
+			got, err := xml.Marshal(doc)
+			if err != nil {
+				t.Fatalf("xml.Marshal failed with '%v'", err)
+			}
+			nlfile := struct {
+				Base64 string `xml:"nlfile>base64"`
+			}{}
+			if err := xml.Unmarshal(got, &nlfile); err != nil {
+				t.Fatalf("xml.Unmarshal failed with '%v'", err)
+			}
+			if content, err := gunzipBase64(nlfile.Base64); err != nil || !bytes.Equal(content, nl) {
+				t.Errorf("got '%s', '%v', want '%s'", content, err, nl)
+			}
+			// The compressed bytes are not part of the golden files
+			got = base64Rgx.ReplaceAll(got, []byte("<base64></base64>"))
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+			// The document must be well-formed and round-trip every field
+			parsed := struct {
+				Email         string `xml:"email"`
+				SolverOptions string `xml:"solver_options"`
+				Adj           string `xml:"adj"`
+				AuxFiles      string `xml:"kestrel_auxfiles"`
+			}{}
+			if err := xml.Unmarshal(got, &parsed); err != nil {
+				t.Fatalf("xml.Unmarshal failed with '%v'", err)
+			}
+			if parsed.Email != tt.submission.Email || parsed.Adj != tt.files["adj"] ||
+				parsed.AuxFiles != tt.submission.AuxOptions["kestrel_auxfiles"] {
+				t.Errorf("got '%+v'", parsed)
+			}
+		})
+	}
+}
+
+func TestTextWriter(t *testing.T) {
+	text := "a < b & \u00e9t\u00e9 \u65e5\u672c \U0001f600"
+	// Every split point must leave the multi-byte characters intact
+	for size := 1; size <= len(text); size++ {
+		buf := new(bytes.Buffer)
+		e := xml.NewEncoder(buf)
+		w := &textWriter{e: e}
+		for i := 0; i < len(text); i += size {
+			end := i + size
+			if end > len(text) {
+				end = len(text)
+			}
+			if _, err := w.Write([]byte(text[i:end])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		want := new(bytes.Buffer)
+		_ = xml.EscapeText(want, []byte(text))
+		if buf.String() != want.String() {
+			t.Errorf("got '%s', want '%s' for size %d", buf, want, size)
+		}
+	}
+}
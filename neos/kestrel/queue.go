@@ -0,0 +1,64 @@
+package kestrel
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// QueueEntry is a job listed by printQueue.
+type QueueEntry struct {
+	Job  int
+	Line string // the description of the job, as printed
+}
+
+// Queue holds the jobs running and waiting on NEOS, in the order of
+// printQueue.
+type Queue struct {
+	Running, Waiting []QueueEntry
+}
+
+var queueEntryRgx = regexp.MustCompile(`^\s*#?(\d+)(\s|$)`)
+
+// ParseQueue parses the output of printQueue, as returned by Client.Queue.
+// Jobs are listed one per line below section headers such as "Running jobs:"
+// and "Queued jobs:"; lines outside of these sections are ignored.
+func ParseQueue(s string) Queue {
+	var q Queue
+	var section *[]QueueEntry
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, ":") {
+			lower := strings.ToLower(line)
+			switch {
+			case strings.Contains(lower, "running"):
+				section = &q.Running
+			case strings.Contains(lower, "queued") || strings.Contains(lower, "waiting"):
+				section = &q.Waiting
+			default:
+				section = nil
+			}
+			continue
+		}
+		match := queueEntryRgx.FindStringSubmatch(line)
+		if section == nil || match == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(match[1]); err == nil {
+			*section = append(*section, QueueEntry{Job: n, Line: line})
+		}
+	}
+	return q
+}
+
+// Position returns the position of a job among the waiting jobs, starting at
+// 1. It returns 0 when the job is not waiting, e.g. because it is already
+// running.
+func (q Queue) Position(jobNumber int) int {
+	for i, entry := range q.Waiting {
+		if entry.Job == jobNumber {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package kestrel
+
+import (
+	"context"
+	"testing"
+
+	"ampl/gokestrel/neos/neostest"
+)
+
+func TestParseQueue(t *testing.T) {
+	q := ParseQueue("NEOS Server queue\n" +
+		"Running jobs:\n" +
+		"  #1001  kestrel  CPLEX  AMPL\n" +
+		"Queued jobs:\n" +
+		"  #1002  kestrel  CPLEX  AMPL\n" +
+		"  #1003  kestrel  Gurobi  AMPL\n" +
+		"  Estimated wait for job 1004 is 10 minutes\n" +
+		"  1005\n" +
+		"Completed jobs:\n" +
+		"  #1000  kestrel  CPLEX  AMPL\n")
+	if len(q.Running) != 1 || q.Running[0] != (QueueEntry{1001, "#1001  kestrel  CPLEX  AMPL"}) {
+		t.Errorf("got '%v', want job 1001 running", q.Running)
+	}
+	if len(q.Waiting) != 3 {
+		t.Errorf("got '%v', want 3 waiting jobs", q.Waiting)
+	}
+	tests := []struct {
+		job, want int
+	}{
+		{1001, 0},
+		{1002, 1},
+		{1003, 2},
+		{1004, 0},
+		{1005, 3},
+		{1000, 0},
+	}
+	for _, test := range tests {
+		if got := q.Position(test.job); got != test.want {
+			t.Errorf("job %d: got '%v', want '%v'", test.job, got, test.want)
+		}
+	}
+	if got := ParseQueue("").Position(1001); got != 0 {
+		t.Errorf("empty queue: got '%v', want '%v'", got, 0)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	srv.Lifecycle = neostest.Lifecycle{Steps: []neostest.Step{{Status: "Waiting"}, {Status: "Done"}}}
+	document, _ := newTestSubmission(t).XML()
+	jobs := []Job{}
+	for i := 0; i < 2; i++ {
+		job, err := c.SubmitJob(ctx, document)
+		if err != nil {
+			t.Fatalf("SubmitJob failed with '%v'", err)
+		}
+		jobs = append(jobs, job)
+	}
+	queue, err := c.Queue(ctx)
+	if err != nil {
+		t.Fatalf("Queue failed with '%v'", err)
+	}
+	q := ParseQueue(queue)
+	for i, job := range jobs {
+		if got := q.Position(job.Number); got != i+1 {
+			t.Errorf("job %d: got '%v', want '%v' in %s", job.Number, got, i+1, queue)
+		}
+	}
+}
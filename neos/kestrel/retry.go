@@ -0,0 +1,104 @@
+package kestrel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how calls failing with a transient error are retried.
+type RetryPolicy struct {
+	MaxAttempts  int           // total number of attempts, 1 disables retries
+	InitialDelay time.Duration // delay before the first retry
+	MaxDelay     time.Duration // upper bound on the delay between attempts
+	Multiplier   float64       // growth factor of the delay after each attempt
+	Jitter       float64       // fraction of each delay that is randomized, in [0, 1]
+
+	// OnRetry, if set, is called before sleeping ahead of a retry.
+	OnRetry func(err error, attempt int, delay time.Duration)
+}
+
+// DefaultRetryPolicy is used by NewClient when Config.Retry is the zero value.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: time.Second,
+	MaxDelay:     30 * time.Second,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Delay returns the delay to wait after the given failed attempt, counting
+// from 1.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		jitterMu.Lock()
+		r := jitterRand.Float64()
+		jitterMu.Unlock()
+		delay -= delay * p.Jitter * r
+	}
+	return time.Duration(delay)
+}
+
+// Do calls fn until it succeeds, fails with an error that is not transient,
+// the attempts are exhausted or ctx is done. It returns the last error.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := p.Delay(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(err, attempt, delay)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// IsTransient reports whether err is a network failure, such as a dropped
+// connection or a timeout, after which the call may succeed if repeated.
+// Answers from the server, including XML-RPC faults and job statuses like
+// "Unknown Job", are not transient, and neither is cancellation of the
+// caller's context.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
@@ -0,0 +1,107 @@
+package kestrel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2}
+	var tests = []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if delay := p.Delay(tt.attempt); delay != tt.delay {
+			t.Errorf("attempt %d: got '%v', want '%v'", tt.attempt, delay, tt.delay)
+		}
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := p.Delay(2); delay < time.Second || delay > 2*time.Second {
+			t.Fatalf("got '%v', want a delay between 1s and 2s", delay)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	var tests = []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{fmt.Errorf("reading response: %w", io.ErrUnexpectedEOF), true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{syscall.ECONNRESET, true},
+		{context.Canceled, false},
+		{errors.New("fault: job not found"), false},
+		{&SubmitError{"bad document"}, false},
+	}
+	for i, tt := range tests {
+		if transient := IsTransient(tt.err); transient != tt.transient {
+			t.Errorf("test #%d: IsTransient(%v) = %v, want %v", i, tt.err, transient, tt.transient)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	ctx := context.Background()
+	retries := 0
+	p := RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, OnRetry: func(error, int, time.Duration) { retries++ }}
+	calls := 0
+	err := p.Do(ctx, func() error {
+		calls++
+		if calls < 3 {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || retries != 2 {
+		t.Errorf("got '%v' after %d calls and %d retries", err, calls, retries)
+	}
+	calls = 0
+	err = p.Do(ctx, func() error {
+		calls++
+		return io.EOF
+	})
+	if err != io.EOF || calls != 3 {
+		t.Errorf("got '%v' after %d calls, want '%v' after 3", err, calls, io.EOF)
+	}
+	calls = 0
+	fault := errors.New("fault")
+	err = p.Do(ctx, func() error {
+		calls++
+		return fault
+	})
+	if err != fault || calls != 1 {
+		t.Errorf("got '%v' after %d calls, want '%v' after 1", err, calls, fault)
+	}
+}
+
+func TestRetryDroppedConnections(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	c.Retry = RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond}
+	srv.DropConnections(0, 2)
+	if status, err := c.JobStatus(ctx, Job{Number: 1}); status != StatusUnknownJob || err != nil {
+		t.Errorf("got '%v', '%v', want '%v'", status, err, StatusUnknownJob)
+	}
+	srv.DropConnections(0, 3)
+	if _, err := c.JobStatus(ctx, Job{Number: 1}); !IsTransient(err) {
+		t.Errorf("got '%v', want a transient error", err)
+	}
+}
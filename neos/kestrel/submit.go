@@ -0,0 +1,161 @@
+package kestrel
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Submit submits the job document of s like SubmitJob. NEOS requires a
+// Content-Length, so the call is encoded once into a temporary file as the
+// .nl file is read and compressed, then sent from there. Memory use does not
+// grow with the size of the model.
+func (c *Client) Submit(ctx context.Context, s *Submission) (Job, error) {
+	doc, err := s.Document()
+	if err != nil {
+		return Job{}, err
+	}
+	method, args := "submitJob", []string{c.User, "kestrel"}
+	if c.Authenticated() {
+		method, args = "authenticatedSubmitJob", []string{c.Username, c.UserPassword, "kestrel"}
+	}
+	body, err := ioutil.TempFile("", "kestrel-*.xml")
+	if err != nil {
+		return Job{}, err
+	}
+	defer os.Remove(body.Name())
+	defer body.Close()
+	if err := writeMethodCall(body, method, doc, args...); err != nil {
+		return Job{}, err
+	}
+	size, err := body.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = body.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, body)
+	if err != nil {
+		return Job{}, err
+	}
+	request.Header.Set("Content-Type", "text/xml")
+	request.ContentLength = size
+	response, err := c.http.Do(request)
+	if err != nil {
+		return Job{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Job{}, fmt.Errorf("unexpected HTTP status %s", response.Status)
+	}
+	results, err := readSubmitResponse(response.Body)
+	if err != nil {
+		return Job{}, err
+	}
+	return submitted(results)
+}
+
+// writeMethodCall writes an XML-RPC call of method with doc as the first
+// argument followed by args, all as string parameters.
+func writeMethodCall(w io.Writer, method string, doc *Document, args ...string) error {
+	e := xml.NewEncoder(w)
+	element := func(name string) xml.StartElement {
+		return xml.StartElement{Name: xml.Name{Local: name}}
+	}
+	tokens := []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0"`)},
+		element("methodCall"),
+		element("methodName"), xml.CharData(method), element("methodName").End(),
+		element("params"),
+		element("param"), element("value"), element("string"),
+	}
+	for _, token := range tokens {
+		if err := e.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	// The document is escaped once more as the text of the first parameter
+	text := &textWriter{e: e}
+	if err := xml.NewEncoder(text).Encode(doc); err != nil {
+		return err
+	}
+	if err := text.Close(); err != nil {
+		return err
+	}
+	tokens = []xml.Token{element("string").End(), element("value").End(), element("param").End()}
+	for _, arg := range args {
+		tokens = append(tokens,
+			element("param"), element("value"), element("string"),
+			xml.CharData(arg),
+			element("string").End(), element("value").End(), element("param").End())
+	}
+	tokens = append(tokens, element("params").End(), element("methodCall").End())
+	for _, token := range tokens {
+		if err := e.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	return e.Flush()
+}
+
+// rpcValue is an XML-RPC value holding a scalar or an array of scalars.
+type rpcValue struct {
+	Int    *string    `xml:"int"`
+	I4     *string    `xml:"i4"`
+	String *string    `xml:"string"`
+	Array  []rpcValue `xml:"array>data>value"`
+	Struct []struct {
+		Name  string   `xml:"name"`
+		Value rpcValue `xml:"value"`
+	} `xml:"struct>member"`
+	Raw string `xml:",chardata"`
+}
+
+func (v rpcValue) value() interface{} {
+	switch {
+	case v.Int != nil:
+		n, _ := strconv.Atoi(strings.TrimSpace(*v.Int))
+		return n
+	case v.I4 != nil:
+		n, _ := strconv.Atoi(strings.TrimSpace(*v.I4))
+		return n
+	case v.String != nil:
+		return *v.String
+	}
+	return v.Raw
+}
+
+// readSubmitResponse decodes the array returned by the submit methods.
+func readSubmitResponse(r io.Reader) ([]interface{}, error) {
+	response := struct {
+		Params []rpcValue `xml:"params>param>value"`
+		Fault  *rpcValue  `xml:"fault>value"`
+	}{}
+	if err := xml.NewDecoder(r).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.Fault != nil {
+		for _, member := range response.Fault.Struct {
+			if member.Name == "faultString" {
+				return nil, fmt.Errorf("fault: %v", member.Value.value())
+			}
+		}
+		return nil, errors.New("fault")
+	}
+	if len(response.Params) != 1 {
+		return nil, fmt.Errorf("unexpected response with %d values", len(response.Params))
+	}
+	results := []interface{}{}
+	for _, v := range response.Params[0].Array {
+		results = append(results, v.value())
+	}
+	return results, nil
+}
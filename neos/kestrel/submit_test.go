@@ -0,0 +1,214 @@
+package kestrel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"ampl/gokestrel/neos/neostest"
+)
+
+func TestSubmit(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	c.User = "tester <a&b>"
+	submission := newTestSubmission(t)
+	submission.Email = "été@test.com"
+	submission.SolverOptions = "logfile=a&b<c>.log"
+	// Large enough to span many writes of the pipeline
+	nl := new(strings.Builder)
+	for i := 0; nl.Len() < 4<<20; i++ {
+		fmt.Fprintf(nl, "%d\t# x[%d] é\n", i*7919%104729, i)
+	}
+	if err := ioutil.WriteFile(submission.Stub+".nl", []byte(nl.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	job, err := c.Submit(ctx, submission)
+	if err != nil {
+		t.Fatalf("Submit failed with '%v'", err)
+	}
+	want, err := submission.XML()
+	if err != nil {
+		t.Fatalf("XML failed with '%v'", err)
+	}
+	got := srv.Job(job.Number)
+	if got == nil {
+		t.Fatalf("job %d was not submitted", job.Number)
+	}
+	if got.Document != want {
+		t.Errorf("got a document of %d bytes, want %d bytes", len(got.Document), len(want))
+	}
+	if got.User != c.User || job.Password != got.Password {
+		t.Errorf("got '%v', '%v', want '%v', '%v'", got.User, job.Password, c.User, got.Password)
+	}
+}
+
+func TestSubmitAuthenticated(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	srv.Users["user"] = "secret"
+	c.Username, c.UserPassword = "user", "secret"
+	job, err := c.Submit(ctx, newTestSubmission(t))
+	if err != nil {
+		t.Fatalf("Submit failed with '%v'", err)
+	}
+	if got := srv.Job(job.Number).User; got != "user" {
+		t.Errorf("got '%v', want 'user'", got)
+	}
+	c.UserPassword = "wrong"
+	var submitErr *SubmitError
+	if _, err := c.Submit(ctx, newTestSubmission(t)); !errors.As(err, &submitErr) {
+		t.Errorf("got '%v', want a SubmitError", err)
+	}
+}
+
+func TestSubmitMissingModel(t *testing.T) {
+	ctx := context.Background()
+	srv, c := newTestClient(t)
+	submission := newTestSubmission(t)
+	if err := os.Remove(submission.Stub + ".nl"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Submit(ctx, submission); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("got '%v', want '%v'", err, os.ErrNotExist)
+	}
+	if srv.Jobs() != 0 {
+		t.Errorf("got %d jobs, want 0", srv.Jobs())
+	}
+}
+
+func TestSubmitCancel(t *testing.T) {
+	srv, c := newTestClient(t)
+	srv.SetDelay(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if _, err := c.Submit(ctx, newTestSubmission(t)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got '%v', want '%v'", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("call took %v", elapsed)
+	}
+}
+
+// slowUpload delays sending request bodies, as a slow link would.
+type slowUpload struct {
+	http.RoundTripper
+	delay time.Duration
+}
+
+func (t slowUpload) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		r.Body = slowBody{r.Body, t.delay}
+	}
+	return t.RoundTripper.RoundTrip(r)
+}
+
+type slowBody struct {
+	io.ReadCloser
+	delay time.Duration
+}
+
+func (b slowBody) Read(p []byte) (int, error) {
+	time.Sleep(b.delay)
+	return b.ReadCloser.Read(p)
+}
+
+func TestSubmitTimeout(t *testing.T) {
+	ctx := context.Background()
+	srv := neostest.NewServer()
+	defer srv.Close()
+	cfg := Config{Host: srv.Host, Port: srv.Port, HTTPClient: srv.Client(), Timeout: 100 * time.Millisecond}
+	c, err := NewClient(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewClient failed with '%v'", err)
+	}
+	// The timeout bounds the wait for the response
+	srv.SetDelay(time.Second)
+	start := time.Now()
+	if _, err := c.Submit(ctx, newTestSubmission(t)); err == nil {
+		t.Errorf("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("call took %v", elapsed)
+	}
+	// but not sending the model
+	srv.SetDelay(0)
+	cfg.HTTPClient = &http.Client{Transport: slowUpload{srv.Client().Transport, 200 * time.Millisecond}}
+	c.http = newUploadHTTPClient(cfg)
+	if _, err := c.Submit(ctx, newTestSubmission(t)); err != nil {
+		t.Errorf("got '%v', want no timeout while uploading", err)
+	}
+}
+
+func TestSubmitMemory(t *testing.T) {
+	ctx := context.Background()
+	// Unlike the fake server, which decodes the whole call, this one discards
+	// the document as it arrives
+	var received int64
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.Copy(ioutil.Discard, r.Body)
+		fmt.Fprint(w, `<?xml version="1.0"?><methodResponse><params><param><value><array><data>`)
+		fmt.Fprint(w, `<value><int>1000</int></value><value><string>pw1000</string></value>`)
+		fmt.Fprint(w, `</data></array></value></param></params></methodResponse>`)
+	}))
+	defer srv.Close()
+	c := &Client{User: "tester", endpoint: srv.URL, http: srv.Client()}
+	// An incompressible model, much larger than the memory Submit may use
+	const size = 32 << 20
+	submission := newTestSubmission(t)
+	f, err := os.Create(submission.Stub + ".nl")
+	if err == nil {
+		_, err = io.CopyN(f, rand.New(rand.NewSource(1)), size)
+		f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	before := stats.HeapInuse
+	peak := before
+	done := make(chan bool)
+	sampled := make(chan bool)
+	go func() {
+		defer close(sampled)
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > peak {
+				peak = stats.HeapInuse
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+	job, err := c.Submit(ctx, submission)
+	close(done)
+	<-sampled
+	if err != nil || job.Number != 1000 {
+		t.Fatalf("got '%v', '%v', want job 1000", job, err)
+	}
+	if received < size {
+		t.Errorf("got a call of %d bytes, want at least %d bytes", received, size)
+	}
+	if growth := peak - before; growth > size/4 {
+		t.Errorf("got a heap growth of %d bytes, want at most %d bytes", growth, size/4)
+	}
+}
@@ -0,0 +1,452 @@
+// Package neostest provides an in-process stand-in for the NEOS XML-RPC
+// server so that kestrel can be exercised end-to-end without network access.
+package neostest
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Step is one stage of a scripted job lifecycle.
+type Step struct {
+	Status string // value reported by getJobStatus, e.g. "Waiting", "Running" or "Done"
+	Output string // appended to the job output when the step is reached
+}
+
+// Lifecycle scripts how a submitted job progresses. Every call to
+// getJobStatus advances the job to its next step; the last step is kept once
+// reached. getFinalResults and killJob jump straight to the end, and killed
+// jobs return their output instead of Solution.
+type Lifecycle struct {
+	Steps          []Step
+	Solution       string            // returned by getFinalResults
+	CompletionCode string            // returned by getCompletionCode once done, "Normal" if empty
+	Files          map[string]string // returned by getOutputFile once done, by file name
+}
+
+// DefaultLifecycle is used for jobs when Server.Lifecycle has no steps.
+var DefaultLifecycle = Lifecycle{
+	Steps: []Step{
+		{Status: "Waiting"},
+		{Status: "Running", Output: "Job submitted to NEOS HTCondor pool.\n"},
+		{Status: "Done", Output: "optimal solution\n"},
+	},
+	Solution: SolFile("optimal solution", []float64{0}, []float64{0, 0}, 0),
+}
+
+// SolFile returns a text AMPL .sol file with the given message, dual and
+// primal values and solve_result_num.
+func SolFile(message string, duals, primals []float64, solveResult int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\nOptions\n3\n1\n1\n0\n", message)
+	fmt.Fprintf(&b, "%d\n%d\n%d\n%d\n", len(duals), len(duals), len(primals), len(primals))
+	for _, values := range [][]float64{duals, primals} {
+		for _, v := range values {
+			fmt.Fprintf(&b, "%g\n", v)
+		}
+	}
+	fmt.Fprintf(&b, "objno 0 %d\n", solveResult)
+	return b.String()
+}
+
+// Job is a job submitted to the server.
+type Job struct {
+	Number   int
+	Password string
+	Document string // the XML document passed to submitJob
+	User     string // user string, or username for authenticated submissions
+	Killed   bool
+
+	lifecycle Lifecycle
+	step      int
+	output    string
+}
+
+// Status returns the status of the current lifecycle step.
+func (j *Job) Status() string {
+	return j.lifecycle.Steps[j.step].Status
+}
+
+func (j *Job) advance() {
+	if j.step+1 < len(j.lifecycle.Steps) {
+		j.step++
+		j.output += j.lifecycle.Steps[j.step].Output
+	}
+}
+
+func (j *Job) finish() {
+	for j.step+1 < len(j.lifecycle.Steps) {
+		j.advance()
+	}
+}
+
+// Server is a fake NEOS server listening on a local TLS port.
+type Server struct {
+	*httptest.Server
+	Host, Port string
+
+	// Solvers is returned by listSolversInCategory("kestrel").
+	Solvers []string
+	// Users holds the username/password pairs accepted by authenticatedSubmitJob.
+	Users map[string]string
+	// Lifecycle is copied into every newly submitted job.
+	Lifecycle Lifecycle
+	// Delay stalls every response, to exercise client timeouts.
+	Delay time.Duration
+
+	mu        sync.Mutex
+	calls     map[string]int
+	jobs      map[int]*Job
+	nextJob   int
+	drop      int
+	dropAfter int
+}
+
+// NewServer starts a fake NEOS server. Use Client to get an http.Client that
+// trusts its certificate and Close to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Solvers: []string{"CPLEX:AMPL", "Gurobi:AMPL", "Ipopt:AMPL", "CPLEX:GAMS"},
+		Users:   map[string]string{},
+		calls:   map[string]int{},
+		jobs:    map[int]*Job{},
+		nextJob: 1000,
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	s.Host, s.Port, _ = net.SplitHostPort(s.Listener.Addr().String())
+	return s
+}
+
+// Address returns the server address in the "host:port" form expected by the
+// neos_server option.
+func (s *Server) Address() string {
+	return net.JoinHostPort(s.Host, s.Port)
+}
+
+// SetDelay sets Delay while the server is running.
+func (s *Server) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Delay = delay
+}
+
+// DropConnections makes the server close the connection without answering,
+// as happens on network failures, for n calls after answering the next
+// after calls normally.
+func (s *Server) DropConnections(after, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropAfter, s.drop = after, n
+}
+
+// Job returns the job with the given number, or nil if there is none.
+func (s *Server) Job(jobNumber int) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[jobNumber]
+}
+
+// Calls returns the number of times method was called.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// Jobs returns the number of jobs submitted so far.
+func (s *Server) Jobs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
+
+type methodCall struct {
+	MethodName string  `xml:"methodName"`
+	Params     []value `xml:"params>param>value"`
+}
+
+type value struct {
+	Int    string  `xml:"int"`
+	I4     string  `xml:"i4"`
+	String *string `xml:"string"`
+	Base64 *string `xml:"base64"`
+	Raw    string  `xml:",chardata"`
+}
+
+func (v value) int() int {
+	n, _ := strconv.Atoi(strings.TrimSpace(v.Int + v.I4))
+	return n
+}
+
+func (v value) string() string {
+	switch {
+	case v.String != nil:
+		return *v.String
+	case v.Base64 != nil:
+		b, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(*v.Base64))
+		return string(b)
+	}
+	return v.Raw
+}
+
+type fault string
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// Like the Python XML-RPC server of NEOS, which reads Content-Length bytes
+	if r.ContentLength < 0 {
+		http.Error(w, "missing Content-Length", http.StatusLengthRequired)
+		return
+	}
+	call := methodCall{}
+	if err := xml.NewDecoder(r.Body).Decode(&call); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	delay := s.Delay
+	drop := s.dropAfter == 0 && s.drop > 0
+	if drop {
+		s.drop--
+	} else if s.dropAfter > 0 {
+		s.dropAfter--
+	}
+	s.mu.Unlock()
+	if drop {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	result := s.dispatch(call.MethodName, call.Params)
+	w.Header().Set("Content-Type", "text/xml")
+	writeResponse(w, result)
+}
+
+func (s *Server) dispatch(method string, params []value) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+	arg := func(i int) value {
+		if i < len(params) {
+			return params[i]
+		}
+		return value{}
+	}
+	switch method {
+	case "ping":
+		return "NeosServer is alive\n"
+	case "listSolversInCategory":
+		solvers := []interface{}{}
+		if arg(0).string() == "kestrel" {
+			for _, solver := range s.Solvers {
+				solvers = append(solvers, solver)
+			}
+		}
+		return solvers
+	case "printQueue":
+		return s.queue()
+	case "submitJob":
+		return s.submitJob(arg(0).string(), arg(1).string())
+	case "authenticatedSubmitJob":
+		username, password := arg(1).string(), arg(2).string()
+		if p, ok := s.Users[username]; !ok || p != password {
+			return []interface{}{0, "Error: Invalid username or password"}
+		}
+		return s.submitJob(arg(0).string(), username)
+	}
+	job, status := s.lookup(arg(0).int(), arg(1).string())
+	switch method {
+	case "getJobStatus":
+		if job == nil {
+			return status
+		}
+		job.advance()
+		return job.Status()
+	case "getIntermediateResults", "getIntermediateResultsNonBlocking":
+		// Never blocks, output is produced by getJobStatus calls
+		output, offset := "", arg(2).int()
+		if job != nil && offset < len(job.output) {
+			output = job.output[offset:]
+			offset = len(job.output)
+		}
+		return []interface{}{[]byte(output), offset}
+	case "getFinalResults":
+		if job == nil {
+			return []byte(status)
+		}
+		job.finish()
+		return []byte(job.results())
+	case "getFinalResultsNonBlocking":
+		if job == nil {
+			return []byte(status)
+		}
+		if job.Status() != "Done" {
+			return []byte{}
+		}
+		return []byte(job.results())
+	case "getCompletionCode":
+		if job == nil {
+			return status
+		}
+		if job.Status() != "Done" {
+			return ""
+		}
+		if job.lifecycle.CompletionCode == "" {
+			return "Normal"
+		}
+		return job.lifecycle.CompletionCode
+	case "getOutputFile":
+		if job == nil {
+			return fault(status)
+		}
+		content, ok := job.lifecycle.Files[arg(2).string()]
+		if !ok || job.Status() != "Done" {
+			return fault(fmt.Sprintf("Output file %s not found for job #%d", arg(2).string(), job.Number))
+		}
+		return []byte(content)
+	case "getJobInfo":
+		if job == nil {
+			return []interface{}{"", "", "", status}
+		}
+		return []interface{}{element(job.Document, "category"), element(job.Document, "solver"), "AMPL", job.Status()}
+	case "killJob":
+		if job == nil {
+			return status
+		}
+		if job.Status() == "Done" {
+			return fmt.Sprintf("Job #%d is finished", job.Number)
+		}
+		job.Killed = true
+		job.step = len(job.lifecycle.Steps) - 1
+		job.output += fmt.Sprintf("Job #%d has been killed by the user.\n", job.Number)
+		return fmt.Sprintf("Job #%d has been killed", job.Number)
+	}
+	return fault(fmt.Sprintf("method \"%s\" is not supported", method))
+}
+
+// results returns the final results of j: its output if it was killed,
+// otherwise the solution.
+func (j *Job) results() string {
+	if j.Killed {
+		return j.output
+	}
+	return j.lifecycle.Solution
+}
+
+// element returns the text of the first <name> element of document.
+func element(document, name string) string {
+	start := strings.Index(document, "<"+name+">")
+	if start < 0 {
+		return ""
+	}
+	start += len(name) + 2
+	end := strings.Index(document[start:], "</"+name+">")
+	if end < 0 {
+		return ""
+	}
+	return strings.TrimSpace(document[start : start+end])
+}
+
+// queue lists the running and waiting jobs in the way of printQueue.
+func (s *Server) queue() string {
+	numbers := make([]int, 0, len(s.jobs))
+	for n := range s.jobs {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	var running, waiting strings.Builder
+	for _, n := range numbers {
+		job := s.jobs[n]
+		line := fmt.Sprintf("  #%d  %s  %s  AMPL\n", n, element(job.Document, "category"), element(job.Document, "solver"))
+		switch job.Status() {
+		case "Running":
+			running.WriteString(line)
+		case "Waiting":
+			waiting.WriteString(line)
+		}
+	}
+	return "Running jobs:\n" + running.String() + "Queued jobs:\n" + waiting.String()
+}
+
+func (s *Server) submitJob(document string, user string) interface{} {
+	if !strings.Contains(document, "<document>") {
+		return []interface{}{0, "Error: malformed job document"}
+	}
+	lifecycle := s.Lifecycle
+	if len(lifecycle.Steps) == 0 {
+		lifecycle = DefaultLifecycle
+	}
+	s.nextJob++
+	job := &Job{
+		Number:    s.nextJob,
+		Password:  fmt.Sprintf("pw%d", s.nextJob),
+		Document:  document,
+		User:      user,
+		lifecycle: lifecycle,
+		output:    lifecycle.Steps[0].Output,
+	}
+	s.jobs[job.Number] = job
+	return []interface{}{job.Number, job.Password}
+}
+
+func (s *Server) lookup(jobNumber int, password string) (*Job, string) {
+	job, ok := s.jobs[jobNumber]
+	if !ok {
+		return nil, "Unknown Job"
+	}
+	if job.Password != password {
+		return nil, "Bad Password"
+	}
+	return job, ""
+}
+
+func writeResponse(w io.Writer, result interface{}) {
+	fmt.Fprint(w, `<?xml version="1.0"?><methodResponse>`)
+	if f, ok := result.(fault); ok {
+		fmt.Fprint(w, `<fault><value><struct>`)
+		fmt.Fprint(w, `<member><name>faultCode</name><value><int>1</int></value></member>`)
+		fmt.Fprint(w, `<member><name>faultString</name>`)
+		writeValue(w, string(f))
+		fmt.Fprint(w, `</member></struct></value></fault></methodResponse>`)
+		return
+	}
+	fmt.Fprint(w, `<params><param>`)
+	writeValue(w, result)
+	fmt.Fprint(w, `</param></params></methodResponse>`)
+}
+
+func writeValue(w io.Writer, v interface{}) {
+	fmt.Fprint(w, "<value>")
+	switch v := v.(type) {
+	case int:
+		fmt.Fprintf(w, "<int>%d</int>", v)
+	case string:
+		fmt.Fprint(w, "<string>")
+		_ = xml.EscapeText(w, []byte(v))
+		fmt.Fprint(w, "</string>")
+	case []byte:
+		fmt.Fprintf(w, "<base64>%s</base64>", base64.StdEncoding.EncodeToString(v))
+	case []interface{}:
+		fmt.Fprint(w, "<array><data>")
+		for _, item := range v {
+			writeValue(w, item)
+		}
+		fmt.Fprint(w, "</data></array>")
+	}
+	fmt.Fprint(w, "</value>")
+}
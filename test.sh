@@ -1,2 +1,2 @@
 #!/bin/bash
-go test ./cmd/gokestrel
+go test ./...